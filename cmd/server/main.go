@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/samdyra/go-geo/internal/api/article"
 	"github.com/samdyra/go-geo/internal/api/geojson"
+	"github.com/samdyra/go-geo/internal/api/job"
 	"github.com/samdyra/go-geo/internal/api/layer"
 	"github.com/samdyra/go-geo/internal/api/layergroup"
 	"github.com/samdyra/go-geo/internal/api/mvt"
@@ -29,20 +30,30 @@ func main() {
 	articleService := article.NewArticleService(db)
 	articleHandler := article.NewArticleHandler(articleService)
 
-	spatialDataService := spatialdata.NewSpatialDataService(db)
+	jobService := job.NewJobService(db, cfg.UploadDir)
+	jobHandler := job.NewJobHandler(jobService)
+
+	tileCache, err := mvt.NewCache(cfg.TileCache, cfg.TileCacheSize, cfg.TileCacheDir)
+	if err != nil {
+		log.Fatalf("Failed to create tile cache: %v", err)
+	}
+	mvtService := mvt.NewMVTService(db, tileCache, cfg.TileCache, cfg.PublicBaseURL)
+	mvtHandler := mvt.NewMVTHandler(mvtService, cfg.TileMaxAge)
+
+	spatialDataService := spatialdata.NewSpatialDataService(db, jobService, cfg.ImportBatchSize, cfg.StoreGeom3857, mvtService)
 	spatialDataHandler := spatialdata.NewSpatialDataHandler(spatialDataService)
 
+	importPool := job.NewPool(jobService, spatialDataService.RunImportJob, cfg.ImportWorkers)
+	importPool.Start()
+
 	layerService := layer.NewService(db)
 	layerHandler := layer.NewHandler(layerService)
 
 	layerGroupService := layergroup.NewService(db)
 	layerGroupHandler := layergroup.NewHandler(layerGroupService)
 
-	mvtService := mvt.NewMVTService(db)
-	mvtHandler := mvt.NewMVTHandler(mvtService)
-
 	geoJSONService := geojson.NewGeoJSONService(db)
-	geoJSONHandler := geojson.NewGeoJSONHandler(geoJSONService)
+	geoJSONHandler := geojson.NewGeoJSONHandler(geoJSONService, cfg.GeoJSONMaxAge)
 
 	reportService := report.NewReportService(db) 
 	reportHandler := report.NewReportHandler(reportService)
@@ -67,8 +78,11 @@ func main() {
 	r.POST("/logout", authHandler.Logout)
 	r.GET("/articles", articleHandler.GetArticles)
 	r.GET("/articles/:id", articleHandler.GetArticle)
-	r.GET("/mvt/:table_name/:z/:x/:y", mvtHandler.GetMVT)
-	r.GET("/geojson/:table_name", geoJSONHandler.GetGeoJSON)
+	r.GET("/mvt/:table_name/:z/:x/:y", middleware.Compress(), mvtHandler.GetMVT)
+	r.GET("/mvt/:table_name/tilejson.json", mvtHandler.GetTileJSON)
+	r.GET("/mvt/group/:group_id/tilejson.json", mvtHandler.GetGroupTileJSON)
+	r.GET("/mvt/group/:group_id/:z/:x/:y", middleware.Compress(), mvtHandler.GetGroupMVT)
+	r.GET("/geojson/:table_name", middleware.Compress(), geoJSONHandler.GetGeoJSON)
 	r.GET("/layer-groups", layerGroupHandler.GetGroupsWithLayers)
 	r.GET("/layers", layerHandler.GetFormattedLayers)
 	r.POST("/reports", reportHandler.CreateReport)
@@ -89,11 +103,23 @@ func main() {
 		spatialData := protected.Group("spatial-data")
 		{
 			spatialData.POST("", spatialDataHandler.CreateSpatialData)
+			spatialData.POST("/preview", spatialDataHandler.PreviewSpatialData)
 			spatialData.DELETE("/:table_name", spatialDataHandler.DeleteSpatialData)
 			spatialData.PUT("/:table_name", spatialDataHandler.EditSpatialData)
 			spatialData.GET("", spatialDataHandler.GetSpatialDataList)
+			spatialData.GET("/:table_name", spatialDataHandler.GetSpatialData)
+			spatialData.GET("/:table_name/gpkg", spatialDataHandler.ExportGeoPackage)
+			spatialData.GET("/:table_name/features", spatialDataHandler.ListFeatures)
+			spatialData.POST("/:table_name/features", spatialDataHandler.CreateFeature)
+			spatialData.GET("/:table_name/features/:id", spatialDataHandler.GetFeature)
+			spatialData.PUT("/:table_name/features/:id", spatialDataHandler.UpdateFeature)
+			spatialData.PATCH("/:table_name/features/:id", spatialDataHandler.UpdateFeature)
+			spatialData.DELETE("/:table_name/features/:id", spatialDataHandler.DeleteFeature)
 		}
 
+		protected.GET("/jobs/:id", jobHandler.GetJob)
+		protected.GET("/mvt/cache/stats", mvtHandler.GetCacheStats)
+
 		layers := protected.Group("layers")
 		{
 			layers.POST("", layerHandler.CreateLayer)
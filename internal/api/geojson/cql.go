@@ -0,0 +1,317 @@
+package geojson
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/samdyra/go-geo/internal/utils/identifier"
+)
+
+// The filter parameter accepts this subset of CQL2 text:
+//
+//	expr      = and { "OR" and }
+//	and       = not { "AND" not }
+//	not       = "NOT" not | "(" expr ")" | predicate
+//	predicate = column op value
+//	          | column ["NOT"] "LIKE" string
+//	          | column ["NOT"] "IN" "(" value { "," value } ")"
+//	          | column ["NOT"] "BETWEEN" value "AND" value
+//	          | column "IS" ["NOT"] "NULL"
+//	op        = "=" | "<>" | "<" | "<=" | ">" | ">="
+//	value     = string | number | "TRUE" | "FALSE"
+//
+// Strings are single quoted with '' for a quote, and columns may be double
+// quoted. Values are always sent as query parameters.
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenKeyword
+	tokenString
+	tokenNumber
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var cqlKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "LIKE": true, "IN": true,
+	"BETWEEN": true, "IS": true, "NULL": true, "TRUE": true, "FALSE": true,
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	r := []rune(input)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ","})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{tokenOp, "="})
+			i++
+		case c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(r) && (r[i+1] == '=' || (c == '<' && r[i+1] == '>')) {
+				op += string(r[i+1])
+			}
+			tokens = append(tokens, token{tokenOp, op})
+			i += len(op)
+		case c == '\'' || c == '"':
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(r) {
+					return nil, fmt.Errorf("unterminated %c", c)
+				}
+				if r[i] == c {
+					if i+1 < len(r) && r[i+1] == c {
+						sb.WriteRune(c)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteRune(r[i])
+				i++
+			}
+			kind := tokenString
+			if c == '"' {
+				kind = tokenIdent
+			}
+			tokens = append(tokens, token{kind, sb.String()})
+		case c == '-' || c == '.' || unicode.IsDigit(c):
+			start := i
+			i++
+			for i < len(r) && (unicode.IsDigit(r[i]) || r[i] == '.' || r[i] == 'e' || r[i] == 'E' ||
+				((r[i] == '-' || r[i] == '+') && (r[i-1] == 'e' || r[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, string(r[start:i])})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(r) && (r[i] == '_' || unicode.IsLetter(r[i]) || unicode.IsDigit(r[i])) {
+				i++
+			}
+			word := string(r[start:i])
+			if cqlKeywords[strings.ToUpper(word)] {
+				tokens = append(tokens, token{tokenKeyword, strings.ToUpper(word)})
+			} else {
+				tokens = append(tokens, token{tokenIdent, word})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+// cqlCompiler turns a filter into a SQL condition, checking every column
+// against the table's columns and adding every value to the query's
+// parameters.
+type cqlCompiler struct {
+	tokens  []token
+	pos     int
+	columns map[string]bool
+	query   *queryBuilder
+}
+
+// compileFilter compiles a CQL2 text filter into a SQL condition.
+func compileFilter(filter string, columns map[string]bool, query *queryBuilder) (string, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return "", err
+	}
+	c := &cqlCompiler{tokens: tokens, columns: columns, query: query}
+	sql, err := c.or()
+	if err != nil {
+		return "", err
+	}
+	if c.peek().kind != tokenEOF {
+		return "", fmt.Errorf("unexpected %q", c.peek().text)
+	}
+	return sql, nil
+}
+
+func (c *cqlCompiler) peek() token {
+	return c.tokens[c.pos]
+}
+
+func (c *cqlCompiler) next() token {
+	t := c.tokens[c.pos]
+	if t.kind != tokenEOF {
+		c.pos++
+	}
+	return t
+}
+
+func (c *cqlCompiler) keyword(word string) bool {
+	if t := c.peek(); t.kind == tokenKeyword && t.text == word {
+		c.pos++
+		return true
+	}
+	return false
+}
+
+func (c *cqlCompiler) or() (string, error) {
+	left, err := c.and()
+	if err != nil {
+		return "", err
+	}
+	for c.keyword("OR") {
+		right, err := c.and()
+		if err != nil {
+			return "", err
+		}
+		left = fmt.Sprintf("(%s OR %s)", left, right)
+	}
+	return left, nil
+}
+
+func (c *cqlCompiler) and() (string, error) {
+	left, err := c.not()
+	if err != nil {
+		return "", err
+	}
+	for c.keyword("AND") {
+		right, err := c.not()
+		if err != nil {
+			return "", err
+		}
+		left = fmt.Sprintf("(%s AND %s)", left, right)
+	}
+	return left, nil
+}
+
+func (c *cqlCompiler) not() (string, error) {
+	if c.keyword("NOT") {
+		operand, err := c.not()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(NOT %s)", operand), nil
+	}
+	if c.peek().kind == tokenLParen {
+		c.next()
+		expr, err := c.or()
+		if err != nil {
+			return "", err
+		}
+		if c.next().kind != tokenRParen {
+			return "", fmt.Errorf("missing )")
+		}
+		return expr, nil
+	}
+	return c.predicate()
+}
+
+func (c *cqlCompiler) predicate() (string, error) {
+	t := c.next()
+	if t.kind != tokenIdent {
+		return "", fmt.Errorf("expected a column, got %q", t.text)
+	}
+	if !c.columns[t.text] {
+		return "", fmt.Errorf("unknown column %q", t.text)
+	}
+	column := identifier.Quote(t.text)
+
+	if t := c.peek(); t.kind == tokenOp {
+		c.next()
+		value, err := c.value()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", column, t.text, value), nil
+	}
+
+	if c.keyword("IS") {
+		not := c.keyword("NOT")
+		if !c.keyword("NULL") {
+			return "", fmt.Errorf("expected NULL after IS")
+		}
+		if not {
+			return column + " IS NOT NULL", nil
+		}
+		return column + " IS NULL", nil
+	}
+
+	negate := ""
+	if c.keyword("NOT") {
+		negate = "NOT "
+	}
+	switch {
+	case c.keyword("LIKE"):
+		pattern := c.next()
+		if pattern.kind != tokenString {
+			return "", fmt.Errorf("LIKE needs a string")
+		}
+		return fmt.Sprintf("%s::text %sLIKE %s", column, negate, c.query.arg(pattern.text)), nil
+	case c.keyword("IN"):
+		if c.next().kind != tokenLParen {
+			return "", fmt.Errorf("expected ( after IN")
+		}
+		var values []string
+		for {
+			value, err := c.value()
+			if err != nil {
+				return "", err
+			}
+			values = append(values, value)
+			if c.peek().kind != tokenComma {
+				break
+			}
+			c.next()
+		}
+		if c.next().kind != tokenRParen {
+			return "", fmt.Errorf("missing ) after IN list")
+		}
+		return fmt.Sprintf("%s %sIN (%s)", column, negate, strings.Join(values, ", ")), nil
+	case c.keyword("BETWEEN"):
+		low, err := c.value()
+		if err != nil {
+			return "", err
+		}
+		if !c.keyword("AND") {
+			return "", fmt.Errorf("expected AND in BETWEEN")
+		}
+		high, err := c.value()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %sBETWEEN %s AND %s", column, negate, low, high), nil
+	}
+	return "", fmt.Errorf("expected an operator after %s", t.text)
+}
+
+// value reads a literal and returns the placeholder of its parameter. The
+// value is sent as text so Postgres converts it to the column's type.
+func (c *cqlCompiler) value() (string, error) {
+	t := c.next()
+	switch {
+	case t.kind == tokenString, t.kind == tokenNumber:
+		return c.query.arg(t.text), nil
+	case t.kind == tokenKeyword && (t.text == "TRUE" || t.text == "FALSE"):
+		return c.query.arg(strings.ToLower(t.text)), nil
+	default:
+		return "", fmt.Errorf("expected a value, got %q", t.text)
+	}
+}
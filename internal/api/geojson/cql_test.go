@@ -0,0 +1,86 @@
+package geojson
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testColumns = map[string]bool{"id": true, "name": true, "population": true, "Kode Desa": true, "capital": true}
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{`population > 1000`, `"population" > $1`, []interface{}{"1000"}},
+		{`population<=-1.5e3`, `"population" <= $1`, []interface{}{"-1.5e3"}},
+		{`name <> 'Bandung'`, `"name" <> $1`, []interface{}{"Bandung"}},
+		{`name = 'Jum''at'`, `"name" = $1`, []interface{}{"Jum'at"}},
+		{`"Kode Desa" = '32'`, `"Kode Desa" = $1`, []interface{}{"32"}},
+		{`capital = TRUE`, `"capital" = $1`, []interface{}{"true"}},
+		{`name LIKE 'Ban%'`, `"name"::text LIKE $1`, []interface{}{"Ban%"}},
+		{`name not like 'Ban%'`, `"name"::text NOT LIKE $1`, []interface{}{"Ban%"}},
+		{`id IN (1, 2, 3)`, `"id" IN ($1, $2, $3)`, []interface{}{"1", "2", "3"}},
+		{`name NOT IN ('a')`, `"name" NOT IN ($1)`, []interface{}{"a"}},
+		{`population BETWEEN 10 AND 20`, `"population" BETWEEN $1 AND $2`, []interface{}{"10", "20"}},
+		{`population NOT BETWEEN 10 AND 20`, `"population" NOT BETWEEN $1 AND $2`, []interface{}{"10", "20"}},
+		{`name IS NULL`, `"name" IS NULL`, nil},
+		{`name is not null`, `"name" IS NOT NULL`, nil},
+		{
+			`population > 10 AND name = 'a' OR capital = false`,
+			`(("population" > $1 AND "name" = $2) OR "capital" = $3)`,
+			[]interface{}{"10", "a", "false"},
+		},
+		{
+			`population > 10 AND (name = 'a' OR NOT capital = true)`,
+			`("population" > $1 AND ("name" = $2 OR (NOT "capital" = $3)))`,
+			[]interface{}{"10", "a", "true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			b := &queryBuilder{}
+			sql, err := compileFilter(tt.filter, testColumns, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("sql = %s, want %s", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(b.args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", b.args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`unknown = 1`,
+		`population`,
+		`population >`,
+		`population > 1 AND`,
+		`(population > 1`,
+		`population > 1)`,
+		`name = 'unterminated`,
+		`"name = 1`,
+		`name LIKE 1`,
+		`name IN 1`,
+		`name IN (1, 2`,
+		`population BETWEEN 1 OR 2`,
+		`name IS 1`,
+		`population = name`,
+		`population; DROP TABLE users`,
+		`1 = 1`,
+	}
+	for _, filter := range tests {
+		t.Run(filter, func(t *testing.T) {
+			b := &queryBuilder{}
+			if sql, err := compileFilter(filter, testColumns, b); err == nil {
+				t.Errorf("compiled to %s, want an error", sql)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package geojson
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/paulmach/orb/encoding/wkt"
+	orbjson "github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
+)
+
+// QueryError is returned when a query parameter of a GeoJSON request cannot
+// be used.
+type QueryError struct {
+	Param   string
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Param, e.Message)
+}
+
+// queryBuilder collects the parameters of a query as its clauses are
+// compiled.
+type queryBuilder struct {
+	args []interface{}
+}
+
+// arg adds a parameter and returns its placeholder.
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// auditColumns are added to every spatial table by the import.
+var auditColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"created_by": true,
+	"updated_by": true,
+}
+
+// tableColumns lists the columns of tableName in table order, leaving out
+// the geometry columns.
+func tableColumns(q sqlx.Queryer, tableName string) ([]string, error) {
+	var columns []string
+	err := sqlx.Select(q, &columns, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND column_name NOT IN ('geom', 'geom_3857')
+		ORDER BY ordinal_position
+	`, tableName)
+	return columns, err
+}
+
+// whereClause compiles the bbox, intersects, within_distance and filter
+// parameters into a WHERE clause for a table whose geometries are in srid.
+func whereClause(q Query, srid int, columns map[string]bool, b *queryBuilder) (string, error) {
+	var conditions []string
+
+	if q.BBox != "" {
+		bbox, err := parseNumbers(q.BBox, 4)
+		if err != nil || bbox[0] > bbox[2] || bbox[1] > bbox[3] {
+			return "", &QueryError{Param: "bbox", Message: "expected min lon,min lat,max lon,max lat"}
+		}
+		conditions = append(conditions, fmt.Sprintf("ST_Intersects(geom, ST_Transform(ST_MakeEnvelope(%s, %s, %s, %s, 4326), %d))",
+			b.arg(bbox[0]), b.arg(bbox[1]), b.arg(bbox[2]), b.arg(bbox[3]), srid))
+	}
+
+	if q.Intersects != "" {
+		geometry, err := intersectsGeometry(q.Intersects, b)
+		if err != nil {
+			return "", &QueryError{Param: "intersects", Message: "expected a WKT or GeoJSON geometry"}
+		}
+		conditions = append(conditions, fmt.Sprintf("ST_Intersects(geom, ST_Transform(%s, %d))", geometry, srid))
+	}
+
+	if q.WithinDistance != "" {
+		point, err := parseNumbers(q.WithinDistance, 3)
+		if err != nil || point[2] < 0 {
+			return "", &QueryError{Param: "within_distance", Message: "expected lon,lat,meters"}
+		}
+		// Distances are measured on the spheroid, so they are in meters
+		// whatever the table's SRID.
+		conditions = append(conditions, fmt.Sprintf("ST_DWithin(ST_Transform(geom, 4326)::geography, ST_SetSRID(ST_MakePoint(%s, %s), 4326)::geography, %s)",
+			b.arg(point[0]), b.arg(point[1]), b.arg(point[2])))
+	}
+
+	if q.Filter != "" {
+		condition, err := compileFilter(q.Filter, columns, b)
+		if err != nil {
+			return "", &QueryError{Param: "filter", Message: err.Error()}
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), nil
+}
+
+// intersectsGeometry checks an intersects geometry and returns the SQL that
+// builds it in WGS 84.
+func intersectsGeometry(value string, b *queryBuilder) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "{") {
+		if _, err := orbjson.UnmarshalGeometry([]byte(value)); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ST_SetSRID(ST_GeomFromGeoJSON(%s), 4326)", b.arg(value)), nil
+	}
+	if _, err := wkt.Unmarshal(value); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ST_GeomFromText(%s, 4326)", b.arg(value)), nil
+}
+
+// selectedColumns returns the columns named in the properties parameter or,
+// when it is empty, every attribute column, plus the audit columns if audit is
+// set. The id is never a property, as it is the feature id.
+func selectedColumns(properties string, audit bool, columns []string) ([]string, error) {
+	var selected []string
+	if properties == "" {
+		for _, name := range columns {
+			if name != "id" && (audit || !auditColumns[name]) {
+				selected = append(selected, name)
+			}
+		}
+		return selected, nil
+	}
+
+	known := make(map[string]bool, len(columns))
+	for _, name := range columns {
+		known[name] = name != "id"
+	}
+	for _, name := range strings.Split(properties, ",") {
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			return nil, &QueryError{Param: "properties", Message: fmt.Sprintf("unknown column %q", name)}
+		}
+		selected = append(selected, name)
+	}
+	return selected, nil
+}
+
+// orderClause compiles the sortby parameter. Features are ordered by id
+// last, so that pages are stable.
+func orderClause(sortBy string, columns map[string]bool) (string, error) {
+	var terms []string
+	for _, term := range strings.Split(sortBy, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		direction := "ASC"
+		switch term[0] {
+		case '-':
+			direction = "DESC"
+			term = term[1:]
+		case '+':
+			term = term[1:]
+		}
+		if !columns[term] {
+			return "", &QueryError{Param: "sortby", Message: fmt.Sprintf("unknown column %q", term)}
+		}
+		terms = append(terms, identifier.Quote(term)+" "+direction)
+	}
+	return "ORDER BY " + strings.Join(append(terms, "id"), ", "), nil
+}
+
+// pageClause compiles the limit and offset parameters. A zero limit returns
+// every feature.
+func pageClause(limit, offset int, b *queryBuilder) (string, error) {
+	if limit < 0 {
+		return "", &QueryError{Param: "limit", Message: "must not be negative"}
+	}
+	if offset < 0 {
+		return "", &QueryError{Param: "offset", Message: "must not be negative"}
+	}
+	var clause string
+	if limit > 0 {
+		clause = "LIMIT " + b.arg(limit)
+	}
+	if offset > 0 {
+		clause += " OFFSET " + b.arg(offset)
+	}
+	return clause, nil
+}
+
+func parseNumbers(value string, count int) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != count {
+		return nil, fmt.Errorf("expected %d numbers", count)
+	}
+	numbers := make([]float64, count)
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
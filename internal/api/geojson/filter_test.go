@@ -0,0 +1,174 @@
+package geojson
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWhereClause(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    Query
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{name: "none", query: Query{}, wantSQL: ""},
+		{
+			name:     "bbox",
+			query:    Query{BBox: "106.7,-6.3,106.9,-6.1"},
+			wantSQL:  "WHERE ST_Intersects(geom, ST_Transform(ST_MakeEnvelope($1, $2, $3, $4, 4326), 32748))",
+			wantArgs: []interface{}{106.7, -6.3, 106.9, -6.1},
+		},
+		{
+			name:     "intersects WKT",
+			query:    Query{Intersects: "POINT(106.8 -6.2)"},
+			wantSQL:  "WHERE ST_Intersects(geom, ST_Transform(ST_GeomFromText($1, 4326), 32748))",
+			wantArgs: []interface{}{"POINT(106.8 -6.2)"},
+		},
+		{
+			name:     "intersects GeoJSON",
+			query:    Query{Intersects: ` {"type":"Point","coordinates":[106.8,-6.2]}`},
+			wantSQL:  "WHERE ST_Intersects(geom, ST_Transform(ST_SetSRID(ST_GeomFromGeoJSON($1), 4326), 32748))",
+			wantArgs: []interface{}{`{"type":"Point","coordinates":[106.8,-6.2]}`},
+		},
+		{
+			name:     "within distance",
+			query:    Query{WithinDistance: "106.8, -6.2, 500"},
+			wantSQL:  "WHERE ST_DWithin(ST_Transform(geom, 4326)::geography, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, $3)",
+			wantArgs: []interface{}{106.8, -6.2, 500.0},
+		},
+		{
+			name:     "bbox and filter",
+			query:    Query{BBox: "0,0,1,1", Filter: "name = 'a'"},
+			wantSQL:  `WHERE ST_Intersects(geom, ST_Transform(ST_MakeEnvelope($1, $2, $3, $4, 4326), 32748)) AND "name" = $5`,
+			wantArgs: []interface{}{0.0, 0.0, 1.0, 1.0, "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &queryBuilder{}
+			sql, err := whereClause(tt.query, 32748, testColumns, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("sql = %s, want %s", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(b.args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", b.args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestWhereClauseErrors(t *testing.T) {
+	tests := []struct {
+		query Query
+		param string
+	}{
+		{Query{BBox: "1,2,3"}, "bbox"},
+		{Query{BBox: "3,0,1,1"}, "bbox"},
+		{Query{BBox: "a,b,c,d"}, "bbox"},
+		{Query{Intersects: "POINT(1"}, "intersects"},
+		{Query{Intersects: `{"type":"Point"`}, "intersects"},
+		{Query{WithinDistance: "1,2"}, "within_distance"},
+		{Query{WithinDistance: "1,2,-5"}, "within_distance"},
+		{Query{Filter: "unknown = 1"}, "filter"},
+	}
+	for _, tt := range tests {
+		_, err := whereClause(tt.query, 4326, testColumns, &queryBuilder{})
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) || queryErr.Param != tt.param {
+			t.Errorf("whereClause(%+v) error = %v, want a %s QueryError", tt.query, err, tt.param)
+		}
+	}
+}
+
+func TestSelectedColumns(t *testing.T) {
+	columns := []string{"id", "name", "population", "created_at", "updated_by"}
+	tests := []struct {
+		properties string
+		audit      bool
+		want       []string
+		wantErr    bool
+	}{
+		{properties: "", want: []string{"name", "population"}},
+		{properties: "", audit: true, want: []string{"name", "population", "created_at", "updated_by"}},
+		{properties: "population, name", want: []string{"population", "name"}},
+		{properties: "created_at", want: []string{"created_at"}},
+		{properties: "id", wantErr: true},
+		{properties: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := selectedColumns(tt.properties, tt.audit, columns)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("selectedColumns(%q) = %v, want an error", tt.properties, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("selectedColumns(%q): %v", tt.properties, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectedColumns(%q, %v) = %v, want %v", tt.properties, tt.audit, got, tt.want)
+		}
+	}
+}
+
+func TestOrderClause(t *testing.T) {
+	tests := []struct {
+		sortBy  string
+		want    string
+		wantErr bool
+	}{
+		{sortBy: "", want: "ORDER BY id"},
+		{sortBy: "name", want: `ORDER BY "name" ASC, id`},
+		{sortBy: "-population,+name", want: `ORDER BY "population" DESC, "name" ASC, id`},
+		{sortBy: "unknown", wantErr: true},
+		{sortBy: "name; DROP TABLE users", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := orderClause(tt.sortBy, testColumns)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("orderClause(%q) = %s, want an error", tt.sortBy, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("orderClause(%q) = %s, %v, want %s", tt.sortBy, got, err, tt.want)
+		}
+	}
+}
+
+func TestPageClause(t *testing.T) {
+	tests := []struct {
+		limit, offset int
+		want          string
+		wantArgs      []interface{}
+		wantErr       bool
+	}{
+		{want: ""},
+		{limit: 10, want: "LIMIT $1", wantArgs: []interface{}{10}},
+		{limit: 10, offset: 20, want: "LIMIT $1 OFFSET $2", wantArgs: []interface{}{10, 20}},
+		{offset: 20, want: " OFFSET $1", wantArgs: []interface{}{20}},
+		{limit: -1, wantErr: true},
+		{offset: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		b := &queryBuilder{}
+		got, err := pageClause(tt.limit, tt.offset, b)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("pageClause(%d, %d) = %s, want an error", tt.limit, tt.offset, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want || !reflect.DeepEqual(b.args, tt.wantArgs) {
+			t.Errorf("pageClause(%d, %d) = %q %v, %v, want %q %v", tt.limit, tt.offset, got, b.args, err, tt.want, tt.wantArgs)
+		}
+	}
+}
@@ -1,30 +1,126 @@
 package geojson
 
 import (
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samdyra/go-geo/internal/utils/errors"
+	"github.com/samdyra/go-geo/internal/utils/httpcache"
+)
+
+// Media types of the GeoJSON responses. A GeoJSON text sequence (RFC 8142)
+// holds one feature per record, each starting with an RS character and
+// ending with a newline.
+const (
+	contentTypeGeoJSON    = "application/json"
+	contentTypeGeoJSONSeq = "application/geo+json-seq"
 )
 
 type GeoJSONHandler struct {
 	geojsonService *GeoJSONService
+	// maxAge is how long clients may reuse a response without revalidating.
+	maxAge time.Duration
 }
 
-func NewGeoJSONHandler(geojsonService *GeoJSONService) *GeoJSONHandler {
-	return &GeoJSONHandler{geojsonService: geojsonService}
+func NewGeoJSONHandler(geojsonService *GeoJSONService, maxAge time.Duration) *GeoJSONHandler {
+	return &GeoJSONHandler{geojsonService: geojsonService, maxAge: maxAge}
 }
 
+// GetGeoJSON streams the features of a table as they are read, as a
+// FeatureCollection or, when the client accepts application/geo+json-seq or
+// asks for format=seq, as a GeoJSON text sequence.
 func (h *GeoJSONHandler) GetGeoJSON(c *gin.Context) {
 	tableName := c.Param("table_name")
 
-	geojson, err := h.geojsonService.GenerateGeoJSON(tableName)
+	var q Query
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	modified, err := h.geojsonService.LastModified(tableName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+	// The response also varies with Accept, which can select a text
+	// sequence.
+	c.Writer.Header().Add("Vary", "Accept")
+	if httpcache.NotModified(c, modified, h.maxAge) {
 		return
 	}
 
-	c.Header("Content-Type", "application/json")
-	c.Data(http.StatusOK, "application/json", geojson)
-}
+	cursor, err := h.geojsonService.OpenFeatures(c.Request.Context(), tableName, q)
+	if err != nil {
+		if queryErr, ok := err.(*QueryError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"type":    "INVALID_QUERY",
+				"message": queryErr.Error(),
+				"param":   queryErr.Param,
+			})
+			return
+		}
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+	defer cursor.Close()
+
+	seq := c.Query("format") == "seq" || strings.Contains(c.GetHeader("Accept"), contentTypeGeoJSONSeq)
+
+	// Without a Content-Length, the response is sent with chunked transfer
+	// encoding and each flushed batch reaches the client right away.
+	contentType := contentTypeGeoJSON
+	if seq {
+		contentType = contentTypeGeoJSONSeq
+	}
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
 
+	w := c.Writer
+	if !seq {
+		w.WriteString(`{"type":"FeatureCollection","features":[`)
+	}
+	first := true
+	for {
+		batch, err := cursor.Next()
+		if err != nil {
+			// The status is already sent; an unterminated response tells the
+			// client the stream failed.
+			log.Printf("Error streaming GeoJSON for table %s: %v", tableName, err)
+			return
+		}
+		if batch == nil {
+			break
+		}
+		for _, feature := range batch {
+			switch {
+			case seq:
+				w.WriteString("\x1e")
+			case !first:
+				w.WriteString(",")
+			}
+			first = false
+			w.Write(feature)
+			if seq {
+				w.WriteString("\n")
+			}
+		}
+		w.Flush()
+	}
+	if !seq {
+		w.WriteString("]}")
+	}
+}
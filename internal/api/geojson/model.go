@@ -0,0 +1,29 @@
+package geojson
+
+// Query holds the filters, paging and column selection of a GeoJSON request.
+// Geometries and coordinates in it are in WGS 84.
+type Query struct {
+	// BBox is "min lon,min lat,max lon,max lat".
+	BBox string `form:"bbox"`
+	// Intersects is a WKT or GeoJSON geometry features must intersect.
+	Intersects string `form:"intersects"`
+	// WithinDistance is "lon,lat,meters".
+	WithinDistance string `form:"within_distance"`
+	// Filter is an attribute filter in a subset of CQL2 text, e.g.
+	// wadmpr = 'Jawa Barat' AND luas > 100.
+	Filter string `form:"filter"`
+	// Properties is a comma separated list of the columns to return. By
+	// default every attribute column is returned.
+	Properties string `form:"properties"`
+	// Audit adds the created_at, updated_at, created_by and updated_by
+	// columns to the default properties.
+	Audit bool `form:"audit"`
+	// Precision is the number of decimal places of the coordinates, 9 by
+	// default.
+	Precision *int `form:"precision"`
+	Limit     int  `form:"limit"`
+	Offset    int  `form:"offset"`
+	// SortBy is a comma separated list of columns, each optionally prefixed
+	// with + (ascending, the default) or - (descending).
+	SortBy string `form:"sortby"`
+}
@@ -1,12 +1,28 @@
 package geojson
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
 )
 
+// Coordinate precision, in decimal places.
+const (
+	defaultPrecision = 9
+	maxPrecision     = 15
+)
+
+// featureBatchSize is the number of features read from the cursor at a time.
+const featureBatchSize = 1000
+
 type GeoJSONService struct {
 	db *sqlx.DB
 }
@@ -15,34 +31,154 @@ func NewGeoJSONService(db *sqlx.DB) *GeoJSONService {
 	return &GeoJSONService{db: db}
 }
 
-func (s *GeoJSONService) GenerateGeoJSON(tableName string) ([]byte, error) {
+// LastModified returns when the data of tableName last changed.
+func (s *GeoJSONService) LastModified(tableName string) (time.Time, error) {
+	var modified time.Time
+	err := s.db.Get(&modified, "SELECT COALESCE(updated_at, 'epoch') FROM spatial_data WHERE table_name = $1", tableName)
+	if err == sql.ErrNoRows {
+		return time.Time{}, errors.ErrNotFound
+	}
+	return modified, err
+}
+
+// OpenFeatures runs the query of a GeoJSON request and returns a cursor over
+// its features, each encoded as a GeoJSON Feature. The first batch is fetched
+// before it returns, so query errors are reported here rather than halfway
+// through a response. The cursor must be closed.
+func (s *GeoJSONService) OpenFeatures(ctx context.Context, tableName string, q Query) (*FeatureCursor, error) {
+	query, args, err := s.featureQuery(tableName, q)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Executing query: %s", query)
+
+	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DECLARE features NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		tx.Rollback()
+		return nil, queryError(err)
+	}
+
+	cursor := &FeatureCursor{tx: tx}
+	cursor.batch, err = cursor.fetch()
+	if err != nil {
+		tx.Rollback()
+		return nil, queryError(err)
+	}
+	return cursor, nil
+}
+
+// featureQuery compiles a GeoJSON request into a query returning one
+// GeoJSON Feature per row.
+func (s *GeoJSONService) featureQuery(tableName string, q Query) (string, []interface{}, error) {
+	// Only tables in the spatial_data catalog are served.
+	var srids []int
+	err := s.db.Select(&srids, "SELECT srid FROM spatial_data WHERE table_name = $1", tableName)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(srids) == 0 {
+		return "", nil, errors.ErrNotFound
+	}
+
+	columns, err := tableColumns(s.db, tableName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	known := make(map[string]bool, len(columns))
+	for _, name := range columns {
+		known[name] = true
+	}
+
+	precision := defaultPrecision
+	if q.Precision != nil {
+		precision = *q.Precision
+		if precision < 0 || precision > maxPrecision {
+			return "", nil, &QueryError{Param: "precision", Message: fmt.Sprintf("must be between 0 and %d", maxPrecision)}
+		}
+	}
+
+	b := &queryBuilder{}
+	where, err := whereClause(q, srids[0], known, b)
+	if err != nil {
+		return "", nil, err
+	}
+	properties, err := selectedColumns(q.Properties, q.Audit, columns)
+	if err != nil {
+		return "", nil, err
+	}
+	order, err := orderClause(q.SortBy, known)
+	if err != nil {
+		return "", nil, err
+	}
+	page, err := pageClause(q.Limit, q.Offset, b)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// row_to_json keeps the column order and gives every value its JSON
+	// type: numbers, booleans, strings and, for json columns, nested JSON.
+	fields := make([]string, len(properties))
+	for i, name := range properties {
+		fields[i] = "features." + identifier.Quote(name)
+	}
+	propertiesSQL := "'{}'::json"
+	if len(fields) > 0 {
+		propertiesSQL = fmt.Sprintf("(SELECT row_to_json(p) FROM (SELECT %s) AS p)", strings.Join(fields, ", "))
+	}
+
 	query := fmt.Sprintf(`
 		SELECT json_build_object(
-			'type', 'FeatureCollection',
-			'features', json_agg(
-				json_build_object(
-					'type', 'Feature',
-					'geometry', ST_AsGeoJSON(geom)::json,
-					'properties', json_build_object(
-						'wadmkc', wadmkc,
-						'wadmkk', wadmkk,
-						'wadmpr', wadmpr
-					)
-				)
-			)
+			'type', 'Feature',
+			'id', features.id,
+			'geometry', ST_AsGeoJSON(ST_Transform(features.geom, 4326), %d)::json,
+			'properties', %s
 		)::text
-		FROM %s;
-	`, tableName)
+		FROM (SELECT * FROM %s %s %s %s) AS features
+	`, precision, propertiesSQL, identifier.Quote(tableName), where, order, page)
+	return query, b.args, nil
+}
 
-	log.Printf("Executing query: %s", query)
+// queryError turns a value that does not convert to its column's type, as
+// in a filter comparing a number column with a word, into a *QueryError.
+func queryError(err error) error {
+	log.Printf("Error executing query: %v", err)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Class() == "22" {
+		return &QueryError{Param: "filter", Message: pqErr.Message}
+	}
+	return err
+}
 
-	var geojson []byte
-	err := s.db.Get(&geojson, query)
-	if err != nil {
-		log.Printf("Error executing query: %v", err)
+// FeatureCursor reads the features of a GeoJSON request in batches.
+type FeatureCursor struct {
+	tx    *sqlx.Tx
+	batch [][]byte
+}
+
+// Next returns the next batch of features, or nil when there are no more.
+func (c *FeatureCursor) Next() ([][]byte, error) {
+	if c.batch != nil {
+		batch := c.batch
+		c.batch = nil
+		return batch, nil
+	}
+	return c.fetch()
+}
+
+func (c *FeatureCursor) fetch() ([][]byte, error) {
+	var batch [][]byte
+	err := c.tx.Select(&batch, fmt.Sprintf("FETCH %d FROM features", featureBatchSize))
+	if err != nil || len(batch) == 0 {
 		return nil, err
 	}
+	return batch, nil
+}
 
-	log.Printf("Successfully generated GeoJSON for table: %s", tableName)
-	return geojson, nil
-}
\ No newline at end of file
+// Close releases the cursor and its connection.
+func (c *FeatureCursor) Close() error {
+	return c.tx.Rollback()
+}
@@ -0,0 +1,38 @@
+package job
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+)
+
+type JobHandler struct {
+	jobService *JobService
+}
+
+func NewJobHandler(jobService *JobService) *JobHandler {
+	return &JobHandler{jobService: jobService}
+}
+
+func (h *JobHandler) GetJob(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	j, err := h.jobService.GetJobByID(id)
+	if err != nil {
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, j)
+}
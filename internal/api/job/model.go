@@ -0,0 +1,47 @@
+package job
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Job statuses, in the order a job normally goes through them.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Job is an import queued by an upload and run by the worker pool.
+type Job struct {
+	ID        int64  `db:"id" json:"id"`
+	Status    string `db:"status" json:"status"`
+	TableName string `db:"table_name" json:"table_name"`
+	Type      string `db:"type" json:"type"`
+	Filename  string `db:"filename" json:"filename"`
+	// FilePath is where the uploaded file is kept until the job finishes.
+	FilePath string `db:"file_path" json:"-"`
+	// Options holds the JSON encoded upload options of the request.
+	Options           []byte         `db:"options" json:"-"`
+	ProcessedFeatures int64          `db:"processed_features" json:"processed_features"`
+	TotalFeatures     *int64         `db:"total_features" json:"total_features"`
+	TableNames        pq.StringArray `db:"table_names" json:"table_names"`
+	Errors            pq.StringArray `db:"errors" json:"errors"`
+	Warnings          pq.StringArray `db:"warnings" json:"warnings"`
+	CreatedBy         string         `db:"created_by" json:"created_by"`
+	CreatedAt         time.Time      `db:"created_at" json:"created_at"`
+	StartedAt         *time.Time     `db:"started_at" json:"started_at"`
+	// HeartbeatAt is when the process running the job last showed it was
+	// alive.
+	HeartbeatAt *time.Time `db:"heartbeat_at" json:"-"`
+	FinishedAt  *time.Time `db:"finished_at" json:"finished_at"`
+}
+
+// Progress reports how many of a running job's features have been processed.
+type Progress func(processed, total int)
+
+// Runner does the work of a job and returns the tables it created and any
+// warnings.
+type Runner func(j *Job, progress Progress) (tableNames, warnings []string, err error)
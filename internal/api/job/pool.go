@@ -0,0 +1,134 @@
+package job
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// pollInterval is how often idle workers look for jobs queued by another
+// server process.
+const pollInterval = 5 * time.Second
+
+// progressInterval limits how often a job's progress is written.
+const progressInterval = time.Second
+
+// heartbeatInterval is how often a running job's heartbeat is written, and
+// leaseTimeout how long after its last heartbeat a running job is taken to
+// have been abandoned by a process that stopped.
+const (
+	heartbeatInterval = 30 * time.Second
+	leaseTimeout      = 2 * time.Minute
+)
+
+// Pool runs queued jobs on a fixed number of workers.
+type Pool struct {
+	service *JobService
+	run     Runner
+	workers int
+}
+
+func NewPool(service *JobService, run Runner, workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{service: service, run: run, workers: workers}
+}
+
+// Start requeues abandoned jobs and starts the workers.
+func (p *Pool) Start() {
+	p.requeueAbandoned()
+	for i := 0; i < p.workers; i++ {
+		go p.work()
+	}
+}
+
+// requeueAbandoned puts back the jobs of processes that stopped while running
+// them. Jobs of processes that are still running keep their heartbeat fresh
+// and are left alone.
+func (p *Pool) requeueAbandoned() {
+	if err := p.service.requeueAbandoned(leaseTimeout); err != nil {
+		log.Printf("Error requeuing import jobs: %v", err)
+	}
+}
+
+func (p *Pool) work() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		j, err := p.service.claimNext()
+		if err != nil {
+			log.Printf("Error claiming import job: %v", err)
+		}
+		if j != nil {
+			p.process(j)
+			continue
+		}
+
+		select {
+		case <-p.service.queued:
+		case <-ticker.C:
+			p.requeueAbandoned()
+		}
+	}
+}
+
+func (p *Pool) process(j *Job) {
+	defer os.Remove(j.FilePath)
+
+	done := make(chan struct{})
+	defer close(done)
+	go p.heartbeat(j.ID, done)
+
+	var lastUpdate time.Time
+	progress := func(processed, total int) {
+		if processed < total && time.Since(lastUpdate) < progressInterval {
+			return
+		}
+		lastUpdate = time.Now()
+		if err := p.service.updateProgress(j.ID, processed, total); err != nil {
+			log.Printf("Error updating import job %d: %v", j.ID, err)
+		}
+	}
+
+	tableNames, warnings, err := p.runSafely(j, progress)
+	if err != nil {
+		log.Printf("Import job %d failed: %v", j.ID, err)
+		err = p.service.fail(j.ID, err)
+	} else {
+		err = p.service.complete(j.ID, tableNames, warnings)
+	}
+	if err != nil {
+		log.Printf("Error finishing import job %d: %v", j.ID, err)
+	}
+}
+
+// heartbeat keeps the lease of a running job until done is closed.
+func (p *Pool) heartbeat(id int64, done <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := p.service.heartbeat(id); err != nil {
+				log.Printf("Error updating import job %d heartbeat: %v", id, err)
+			}
+		}
+	}
+}
+
+// runSafely turns a panic in the runner into a failed job instead of a dead
+// worker.
+func (p *Pool) runSafely(j *Job, progress Progress) (tableNames, warnings []string, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			tableNames, warnings, err = nil, nil, fmt.Errorf("import panicked: %v", rec)
+		}
+	}()
+	return p.run(j, progress)
+}
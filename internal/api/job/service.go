@@ -0,0 +1,137 @@
+package job
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+)
+
+type JobService struct {
+	db        *sqlx.DB
+	uploadDir string
+	// queued wakes an idle worker when a job is created.
+	queued chan struct{}
+}
+
+func NewJobService(db *sqlx.DB, uploadDir string) *JobService {
+	if uploadDir == "" {
+		uploadDir = os.TempDir()
+	}
+	return &JobService{db: db, uploadDir: uploadDir, queued: make(chan struct{}, 1)}
+}
+
+// CreateJob stores the uploaded file in the upload directory and queues j.
+func (s *JobService) CreateJob(j *Job, file io.Reader) error {
+	tmp, err := os.CreateTemp(s.uploadDir, "import-*"+strings.ToLower(filepath.Ext(j.Filename)))
+	if err != nil {
+		log.Printf("Error creating upload file: %v", err)
+		return errors.ErrInternalServer
+	}
+	_, err = io.Copy(tmp, file)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.ErrInternalServer
+	}
+
+	err = s.db.QueryRowx(`
+		INSERT INTO import_job (status, table_name, type, filename, file_path, options, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING *
+	`, StatusQueued, j.TableName, j.Type, j.Filename, tmp.Name(), j.Options, j.CreatedBy).StructScan(j)
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Error creating import job: %v", err)
+		return errors.ErrInternalServer
+	}
+
+	select {
+	case s.queued <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (s *JobService) GetJobByID(id int64) (*Job, error) {
+	var j Job
+	err := s.db.Get(&j, "SELECT * FROM import_job WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return &j, nil
+}
+
+// claimNext marks the oldest queued job as running and returns it, or nil if
+// the queue is empty. SKIP LOCKED lets several workers poll at once.
+func (s *JobService) claimNext() (*Job, error) {
+	var j Job
+	err := s.db.Get(&j, `
+		UPDATE import_job SET status = $1, started_at = CURRENT_TIMESTAMP, heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM import_job WHERE status = $2
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING *
+	`, StatusRunning, StatusQueued)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// requeueAbandoned puts back running jobs whose heartbeat is older than
+// lease, which were left behind by a server process that stopped.
+func (s *JobService) requeueAbandoned(lease time.Duration) error {
+	_, err := s.db.Exec(`
+		UPDATE import_job SET status = $1, started_at = NULL, heartbeat_at = NULL, processed_features = 0
+		WHERE status = $2 AND COALESCE(heartbeat_at, started_at) < CURRENT_TIMESTAMP - $3 * INTERVAL '1 second'
+	`, StatusQueued, StatusRunning, lease.Seconds())
+	return err
+}
+
+// heartbeat records that the job is still being run.
+func (s *JobService) heartbeat(id int64) error {
+	_, err := s.db.Exec("UPDATE import_job SET heartbeat_at = CURRENT_TIMESTAMP WHERE id = $1", id)
+	return err
+}
+
+func (s *JobService) updateProgress(id int64, processed, total int) error {
+	_, err := s.db.Exec(`
+		UPDATE import_job SET processed_features = $1, total_features = $2
+		WHERE id = $3
+	`, processed, total, id)
+	return err
+}
+
+func (s *JobService) complete(id int64, tableNames, warnings []string) error {
+	_, err := s.db.Exec(`
+		UPDATE import_job SET status = $1, table_names = $2, warnings = $3, finished_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, StatusCompleted, pq.StringArray(tableNames), pq.StringArray(warnings), id)
+	return err
+}
+
+func (s *JobService) fail(id int64, jobErr error) error {
+	_, err := s.db.Exec(`
+		UPDATE import_job SET status = $1, errors = array_append(errors, $2), finished_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, StatusFailed, jobErr.Error(), id)
+	return err
+}
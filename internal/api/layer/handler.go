@@ -38,7 +38,12 @@ func (h *Handler) CreateLayer(c *gin.Context) {
 
     err := h.service.CreateLayer(input, username.(string))
     if err != nil {
-        c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+        switch err {
+        case errors.ErrInvalidInput:
+            c.JSON(http.StatusBadRequest, errors.NewAPIError(err))
+        default:
+            c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+        }
         return
     }
 
@@ -131,6 +136,8 @@ func (h *Handler) UpdateLayer(c *gin.Context) {
     if err != nil {
 
         switch err {
+        case errors.ErrInvalidInput:
+            c.JSON(http.StatusBadRequest, errors.NewAPIError(err))
         case errors.ErrNotFound:
             c.JSON(http.StatusNotFound, errors.NewAPIError(err))
         default:
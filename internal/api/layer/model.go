@@ -11,6 +11,8 @@ type Layer struct {
     LayerName      string    `db:"layer_name" json:"layer_name"`
     Coordinate     []float64 `db:"coordinate" json:"coordinate"`
     Color          string    `db:"color" json:"color"`
+    MinZoom        int       `db:"min_zoom" json:"min_zoom"`
+    MaxZoom        int       `db:"max_zoom" json:"max_zoom"`
     CreatedAt      time.Time `db:"created_at" json:"created_at"`
     UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
     CreatedBy      string     `db:"created_by" json:"created_by"`
@@ -22,12 +24,18 @@ type LayerCreate struct {
     LayerName     string    `json:"layer_name" binding:"required"`
     Coordinate    []float64 `json:"coordinate" binding:"required"`
     Color         string    `json:"color" binding:"required"`
+    // MinZoom and MaxZoom limit the zoom levels the layer is drawn and
+    // tiled at; they default to 0 and 22.
+    MinZoom       *int      `json:"min_zoom" binding:"omitempty,min=0,max=22"`
+    MaxZoom       *int      `json:"max_zoom" binding:"omitempty,min=0,max=22"`
 }
 
 type LayerUpdate struct {
     LayerName  *string    `json:"layer_name"`
     Coordinate *[]float64 `json:"coordinate"`
     Color      *string    `json:"color"`
+    MinZoom    *int       `json:"min_zoom" binding:"omitempty,min=0,max=22"`
+    MaxZoom    *int       `json:"max_zoom" binding:"omitempty,min=0,max=22"`
 }
 
 type FormattedLayer struct {
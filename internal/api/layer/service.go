@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/samdyra/go-geo/internal/utils"
 	"github.com/samdyra/go-geo/internal/utils/errors"
 )
@@ -20,18 +21,29 @@ func NewService(db *sqlx.DB) *Service {
 }
 
 func (s *Service) CreateLayer(layer LayerCreate, username string) error {
-    query := `INSERT INTO layer (spatial_data_id, layer_name, coordinate, color, created_at, updated_at, created_by, updated_by)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+    query := `INSERT INTO layer (spatial_data_id, layer_name, coordinate, color, min_zoom, max_zoom, created_at, updated_at, created_by, updated_by)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
     
     now := time.Now()
 
+    minZoom, maxZoom := 0, 22
+    if layer.MinZoom != nil {
+        minZoom = *layer.MinZoom
+    }
+    if layer.MaxZoom != nil {
+        maxZoom = *layer.MaxZoom
+    }
+    if minZoom > maxZoom {
+        return errors.ErrInvalidInput
+    }
+
     // Convert the coordinate slice to a JSON string
     coordinateJSON, err := json.Marshal(layer.Coordinate)
     if err != nil {
         return errors.ErrInternalServer
     }
 
-    _, err = s.db.Exec(query, layer.SpatialDataID, layer.LayerName, coordinateJSON, layer.Color, now, now, username, username)
+    _, err = s.db.Exec(query, layer.SpatialDataID, layer.LayerName, coordinateJSON, layer.Color, minZoom, maxZoom, now, now, username, username)
     if err != nil {
 
         return errors.ErrInternalServer
@@ -68,6 +80,18 @@ func (s *Service) UpdateLayer(id int64, update LayerUpdate, username string) err
 
         argCount++
     }
+    if update.MinZoom != nil {
+        query += fmt.Sprintf(", min_zoom = $%d", argCount)
+        args = append(args, *update.MinZoom)
+
+        argCount++
+    }
+    if update.MaxZoom != nil {
+        query += fmt.Sprintf(", max_zoom = $%d", argCount)
+        args = append(args, *update.MaxZoom)
+
+        argCount++
+    }
 
     query += fmt.Sprintf(" WHERE id = $%d", argCount)
     args = append(args, id)
@@ -76,6 +100,10 @@ func (s *Service) UpdateLayer(id int64, update LayerUpdate, username string) err
 
     result, err := s.db.Exec(query, args...)
     if err != nil {
+        // A zoom range with min_zoom above max_zoom.
+        if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23514" {
+            return errors.ErrInvalidInput
+        }
         return errors.ErrInternalServer
     }
 
@@ -102,6 +130,14 @@ func (s *Service) DeleteLayer(id int64) error {
     }
     defer tx.Rollback()
 
+    // Group tiles are versioned by the group's updated_at, so the groups
+    // losing the layer are touched.
+    _, err = tx.Exec(`UPDATE layer_group SET updated_at = CURRENT_TIMESTAMP
+        WHERE id IN (SELECT layer_group_id FROM layer_layer_group WHERE layer_id = $1)`, id)
+    if err != nil {
+        return errors.ErrInternalServer
+    }
+
     // Delete from layer_layer_group
     _, err = tx.Exec("DELETE FROM layer_layer_group WHERE layer_id = $1", id)
     if err != nil {
@@ -126,7 +162,7 @@ func (s *Service) DeleteLayer(id int64) error {
 }
 
 func (s *Service) GetAllFormattedLayers() ([]FormattedLayer, error) {
-	query := `SELECT l.id, l.layer_name, l.coordinate, l.color, sd.table_name, sd.type 
+	query := `SELECT l.id, l.layer_name, l.coordinate, l.color, l.min_zoom, l.max_zoom, sd.table_name, sd.type 
               FROM layer l
               JOIN spatial_data sd ON l.spatial_data_id = sd.id`
 	
@@ -139,7 +175,7 @@ func (s *Service) GetAllFormattedLayers() ([]FormattedLayer, error) {
 }
 
 func (s *Service) GetFormattedLayers(ids []int64) ([]FormattedLayer, error) {
-	query := `SELECT l.id, l.layer_name, l.coordinate, l.color, sd.table_name, sd.type 
+	query := `SELECT l.id, l.layer_name, l.coordinate, l.color, l.min_zoom, l.max_zoom, sd.table_name, sd.type 
               FROM layer l
               JOIN spatial_data sd ON l.spatial_data_id = sd.id
               WHERE l.id IN (?)`
@@ -169,8 +205,9 @@ func (s *Service) queryFormattedLayers(query string, args ...interface{}) ([]For
 	for rows.Next() {
 		var id int64
 		var layerName, color, tableName, dataType string
+		var minZoom, maxZoom int
 		var coordinateBytes []byte
-		err := rows.Scan(&id, &layerName, &coordinateBytes, &color, &tableName, &dataType)
+		err := rows.Scan(&id, &layerName, &coordinateBytes, &color, &minZoom, &maxZoom, &tableName, &dataType)
 		if err != nil {
 			return nil, errors.ErrInternalServer
 		}
@@ -193,6 +230,8 @@ func (s *Service) queryFormattedLayers(query string, args ...interface{}) ([]For
 			"source-layer": tableName,
 			"type":         layerType,
 			"paint":        paint,
+			"minzoom":      minZoom,
+			"maxzoom":      maxZoom,
 		}
 
 		layerJSON, err := json.Marshal(layer)
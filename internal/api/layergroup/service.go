@@ -96,10 +96,16 @@ func (s *Service) GetGroupsWithLayers() ([]GroupWithLayers, error) {
 }
 
 func (s *Service) RemoveLayerFromGroup(layerID, groupID int64) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	defer tx.Rollback()
+
 	query := `DELETE FROM layer_layer_group
               WHERE layer_id = $1 AND layer_group_id = $2`
 	
-	result, err := s.db.Exec(query, layerID, groupID)
+	result, err := tx.Exec(query, layerID, groupID)
 	if err != nil {
 		return errors.ErrInternalServer
 	}
@@ -112,6 +118,17 @@ func (s *Service) RemoveLayerFromGroup(layerID, groupID int64) error {
 	if rowsAffected == 0 {
 		return errors.ErrNotFound
 	}
+
+	// Group tiles are versioned by the latest updated_at of the group and its
+	// members, which a removal does not otherwise change.
+	_, err = tx.Exec("UPDATE layer_group SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", groupID)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.ErrInternalServer
+	}
 	
 	return nil
 }
@@ -0,0 +1,155 @@
+package mvt
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// Tile cache backends, chosen with TILE_CACHE.
+const (
+	CacheNone   = "none"
+	CacheMemory = "memory"
+	CacheDisk   = "disk"
+)
+
+// TileKey identifies a cached tile. Version changes whenever the table's data
+// does, so tiles cached before an edit are never served after it.
+type TileKey struct {
+	Table   string
+	Version int64
+	Z, X, Y int
+	// Fields is the attribute selection of the tile, "" for the default.
+	Fields string
+	// Layer is the name of the tile's layer, "" when it is named after the
+	// table.
+	Layer string
+}
+
+// Cache stores generated tiles. Implementations must be safe for concurrent
+// use.
+type Cache interface {
+	Get(key TileKey) ([]byte, bool)
+	Set(key TileKey, tile []byte)
+	// Invalidate drops every cached tile of table.
+	Invalidate(table string)
+}
+
+// CacheStats counts the tile requests served from and missing in the cache.
+type CacheStats struct {
+	Backend       string `json:"backend"`
+	Hits          int64  `json:"hits"`
+	Misses        int64  `json:"misses"`
+	Invalidations int64  `json:"invalidations"`
+}
+
+// NewCache returns the tile cache for backend: an LRU of size tiles in
+// memory, a directory of tile files, or nil for none.
+func NewCache(backend string, size int, dir string) (Cache, error) {
+	switch backend {
+	case "", CacheNone:
+		return nil, nil
+	case CacheMemory:
+		return NewMemoryCache(size)
+	case CacheDisk:
+		return NewDiskCache(dir)
+	default:
+		return nil, fmt.Errorf("unknown tile cache %q", backend)
+	}
+}
+
+// MemoryCache keeps the most recently used tiles in memory.
+type MemoryCache struct {
+	tiles *lru.Cache[TileKey, []byte]
+}
+
+func NewMemoryCache(size int) (*MemoryCache, error) {
+	tiles, err := lru.New[TileKey, []byte](size)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryCache{tiles: tiles}, nil
+}
+
+func (c *MemoryCache) Get(key TileKey) ([]byte, bool) {
+	return c.tiles.Get(key)
+}
+
+func (c *MemoryCache) Set(key TileKey, tile []byte) {
+	c.tiles.Add(key, tile)
+}
+
+func (c *MemoryCache) Invalidate(table string) {
+	for _, key := range c.tiles.Keys() {
+		if key.Table == table {
+			c.tiles.Remove(key)
+		}
+	}
+}
+
+// DiskCache keeps tiles as files under dir, one directory per table.
+type DiskCache struct {
+	dir string
+	// seq names temporary files, so concurrent writes of a tile do not
+	// clash.
+	seq atomic.Int64
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "go-geo-tiles")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(key TileKey) string {
+	name := fmt.Sprintf("%d.mvt", key.Y)
+	if key.Fields != "" || key.Layer != "" {
+		h := fnv.New64a()
+		h.Write([]byte(key.Layer + "\x00" + key.Fields))
+		name = fmt.Sprintf("%d-%x.mvt", key.Y, h.Sum64())
+	}
+	return filepath.Join(c.dir, key.Table, fmt.Sprint(key.Version), fmt.Sprint(key.Z), fmt.Sprint(key.X), name)
+}
+
+func (c *DiskCache) Get(key TileKey) ([]byte, bool) {
+	tile, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return tile, true
+}
+
+// Set writes the tile to a temporary file and renames it into place, so a
+// reader never sees a partial tile. Failures only cost a later cache miss.
+func (c *DiskCache) Set(key TileKey, tile []byte) {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", path, c.seq.Add(1))
+	if err := os.WriteFile(tmp, tile, 0o644); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+func (c *DiskCache) Invalidate(table string) {
+	// Table names are identifiers, but a stray separator must not reach
+	// outside the cache directory.
+	if table == "" || strings.ContainsAny(table, `/\`) || table == "." || table == ".." {
+		return
+	}
+	os.RemoveAll(filepath.Join(c.dir, table))
+}
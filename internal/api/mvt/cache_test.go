@@ -0,0 +1,141 @@
+package mvt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewCache(t *testing.T) {
+	tests := []struct {
+		backend string
+		want    string
+		wantErr bool
+	}{
+		{backend: "", want: ""},
+		{backend: CacheNone, want: ""},
+		{backend: CacheMemory, want: "*mvt.MemoryCache"},
+		{backend: CacheDisk, want: "*mvt.DiskCache"},
+		{backend: "redis", wantErr: true},
+	}
+	for _, tt := range tests {
+		cache, err := NewCache(tt.backend, 10, t.TempDir())
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewCache(%q) succeeded, want an error", tt.backend)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NewCache(%q): %v", tt.backend, err)
+		}
+		got := ""
+		switch cache.(type) {
+		case *MemoryCache:
+			got = "*mvt.MemoryCache"
+		case *DiskCache:
+			got = "*mvt.DiskCache"
+		}
+		if got != tt.want {
+			t.Errorf("NewCache(%q) = %s, want %s", tt.backend, got, tt.want)
+		}
+	}
+}
+
+// testCache runs the behaviour every Cache must have against cache.
+func testCache(t *testing.T, cache Cache) {
+	key := TileKey{Table: "roads", Version: 1, Z: 12, X: 3263, Y: 2118}
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("Get() hit on an empty cache")
+	}
+
+	cache.Set(key, []byte("roads v1"))
+	if tile, ok := cache.Get(key); !ok || !bytes.Equal(tile, []byte("roads v1")) {
+		t.Fatalf("Get() = %q, %v, want the tile", tile, ok)
+	}
+
+	// Tiles differing in any part of their key are cached apart.
+	others := []TileKey{
+		{Table: "roads", Version: 2, Z: 12, X: 3263, Y: 2118},
+		{Table: "roads", Version: 1, Z: 12, X: 3263, Y: 2119},
+		{Table: "roads", Version: 1, Z: 12, X: 3263, Y: 2118, Fields: "name"},
+		{Table: "roads", Version: 1, Z: 12, X: 3263, Y: 2118, Layer: "main roads"},
+		{Table: "rivers", Version: 1, Z: 12, X: 3263, Y: 2118},
+	}
+	for _, other := range others {
+		if _, ok := cache.Get(other); ok {
+			t.Errorf("Get(%+v) hit the tile of %+v", other, key)
+		}
+	}
+	river := TileKey{Table: "rivers", Version: 1, Z: 12, X: 3263, Y: 2118}
+	cache.Set(river, []byte("rivers v1"))
+	named := TileKey{Table: "roads", Version: 1, Z: 12, X: 3263, Y: 2118, Layer: "main roads"}
+	cache.Set(named, []byte("main roads v1"))
+
+	// Invalidating a table drops all its tiles and only them.
+	cache.Invalidate("roads")
+	if _, ok := cache.Get(key); ok {
+		t.Error("Get() hit after Invalidate()")
+	}
+	if _, ok := cache.Get(named); ok {
+		t.Error("Get() hit a named layer tile after Invalidate()")
+	}
+	if tile, ok := cache.Get(river); !ok || !bytes.Equal(tile, []byte("rivers v1")) {
+		t.Errorf("Get() of another table = %q, %v after Invalidate(), want the tile", tile, ok)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	cache, err := NewMemoryCache(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCache(t, cache)
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	cache, err := NewMemoryCache(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 3; y++ {
+		cache.Set(TileKey{Table: "roads", Y: y}, []byte{byte(y)})
+	}
+	if _, ok := cache.Get(TileKey{Table: "roads", Y: 0}); ok {
+		t.Error("the least recently used tile was not evicted")
+	}
+	if _, ok := cache.Get(TileKey{Table: "roads", Y: 2}); !ok {
+		t.Error("the newest tile was evicted")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCache(t, cache)
+}
+
+func TestDiskCacheInvalidateStaysInDir(t *testing.T) {
+	parent := t.TempDir()
+	outside := filepath.Join(parent, "outside")
+	if err := os.WriteFile(outside, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewDiskCache(filepath.Join(parent, "tiles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"", ".", "..", "../outside", `..\outside`} {
+		cache.Invalidate(table)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("Invalidate() removed a file outside the cache: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "tiles")); err != nil {
+		t.Errorf("Invalidate() removed the cache directory: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package mvt
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+)
+
+// GroupLastModified returns when a layer group, its membership, its layers
+// or their tables last changed.
+func (s *MVTService) GroupLastModified(groupID int64) (time.Time, error) {
+	var modified time.Time
+	err := s.db.Get(&modified, `
+		SELECT COALESCE(GREATEST(lg.updated_at, MAX(llg.updated_at), MAX(l.updated_at), MAX(sd.updated_at)), 'epoch')
+		FROM layer_group lg
+		LEFT JOIN layer_layer_group llg ON llg.layer_group_id = lg.id
+		LEFT JOIN layer l ON l.id = llg.layer_id
+		LEFT JOIN spatial_data sd ON sd.id = l.spatial_data_id
+		WHERE lg.id = $1
+		GROUP BY lg.id
+	`, groupID)
+	if err == sql.ErrNoRows {
+		return time.Time{}, errors.ErrNotFound
+	}
+	return modified, err
+}
+
+// groupLayer is a layer of a layer group with the table it draws. Name is the
+// name of its layer in the group tiles.
+type groupLayer struct {
+	tileTable
+	Name    string          `db:"name"`
+	MinZoom int             `db:"min_zoom"`
+	MaxZoom int             `db:"max_zoom"`
+	BBox    pq.Float64Array `db:"bbox"`
+}
+
+// groupLayers returns the layers of a layer group in the order they were
+// added to it. Tile layers are named after their layer; layers of the group
+// sharing a name get their id appended, as layer names in a tile must be
+// unique.
+func (s *MVTService) groupLayers(groupID int64) ([]groupLayer, error) {
+	var layers []groupLayer
+	err := s.db.Select(&layers, `
+		SELECT `+tileTableColumns+`, sd.bbox, l.min_zoom, l.max_zoom,
+			CASE WHEN count(*) OVER (PARTITION BY l.layer_name) > 1
+				THEN l.layer_name || '_' || l.id
+				ELSE l.layer_name
+			END AS name
+		FROM layer_layer_group llg
+		JOIN layer l ON l.id = llg.layer_id
+		JOIN spatial_data sd ON sd.id = l.spatial_data_id
+		WHERE llg.layer_group_id = $1
+		ORDER BY llg.id
+	`, groupID)
+	return layers, err
+}
+
+// GenerateGroupMVT returns the tile z/x/y of a layer group: one layer per
+// layer of the group drawn at zoom z, cut from its table. The table tiles come
+// from the shared tile cache, and are concatenated, which yields a valid tile
+// holding all their layers.
+func (s *MVTService) GenerateGroupMVT(groupID int64, z, x, y int) ([]byte, error) {
+	var exists bool
+	err := s.db.Get(&exists, "SELECT EXISTS (SELECT FROM layer_group WHERE id = $1)", groupID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.ErrNotFound
+	}
+
+	layers, err := s.groupLayers(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var mvt []byte
+	for _, layer := range layers {
+		if z < layer.MinZoom || z > layer.MaxZoom {
+			continue
+		}
+		tile, err := s.tableTile(layer.tileTable, layer.Name, z, x, y, nil)
+		if err != nil {
+			return nil, err
+		}
+		mvt = append(mvt, tile...)
+	}
+	return mvt, nil
+}
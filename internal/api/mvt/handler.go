@@ -3,17 +3,22 @@ package mvt
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samdyra/go-geo/internal/utils/errors"
+	"github.com/samdyra/go-geo/internal/utils/httpcache"
 )
 
 type MVTHandler struct {
 	mvtService *MVTService
+	// maxAge is how long clients may reuse a tile without revalidating.
+	maxAge time.Duration
 }
 
-func NewMVTHandler(mvtService *MVTService) *MVTHandler {
-	return &MVTHandler{mvtService: mvtService}
+func NewMVTHandler(mvtService *MVTService, maxAge time.Duration) *MVTHandler {
+	return &MVTHandler{mvtService: mvtService, maxAge: maxAge}
 }
 
 func (h *MVTHandler) GetMVT(c *gin.Context) {
@@ -22,12 +27,121 @@ func (h *MVTHandler) GetMVT(c *gin.Context) {
 	x, _ := strconv.Atoi(c.Param("x"))
 	y, _ := strconv.Atoi(c.Param("y"))
 
-	mvt, err := h.mvtService.GenerateMVT(tableName, z, x, y)
+	modified, err := h.mvtService.LastModified(tableName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+	if httpcache.NotModified(c, modified, h.maxAge) {
+		return
+	}
+
+	var fields []string
+	if f := c.Query("fields"); f != "" {
+		fields = strings.Split(f, ",")
+	}
+
+	mvt, err := h.mvtService.GenerateMVT(tableName, z, x, y, fields)
+	if err != nil {
+		switch err {
+		case errors.ErrInvalidInput:
+			c.JSON(http.StatusBadRequest, errors.NewAPIError(err))
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
 		return
 	}
 
 	c.Header("Content-Type", "application/x-protobuf")
 	c.Data(http.StatusOK, "application/x-protobuf", mvt)
-}
\ No newline at end of file
+}
+
+// GetGroupMVT returns a tile holding a layer per table of a layer group.
+func (h *MVTHandler) GetGroupMVT(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+	z, _ := strconv.Atoi(c.Param("z"))
+	x, _ := strconv.Atoi(c.Param("x"))
+	y, _ := strconv.Atoi(c.Param("y"))
+
+	modified, err := h.mvtService.GroupLastModified(groupID)
+	if err != nil {
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+	if httpcache.NotModified(c, modified, h.maxAge) {
+		return
+	}
+
+	mvt, err := h.mvtService.GenerateGroupMVT(groupID, z, x, y)
+	if err != nil {
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+
+	c.Data(http.StatusOK, "application/x-protobuf", mvt)
+}
+
+// GetTileJSON describes the tiles of a table as TileJSON.
+func (h *MVTHandler) GetTileJSON(c *gin.Context) {
+	tileJSON, err := h.mvtService.TileJSON(c.Param("table_name"))
+	if err != nil {
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tileJSON)
+}
+
+// GetGroupTileJSON describes the composite tiles of a layer group as
+// TileJSON.
+func (h *MVTHandler) GetGroupTileJSON(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("group_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	tileJSON, err := h.mvtService.GroupTileJSON(groupID)
+	if err != nil {
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tileJSON)
+}
+
+// GetCacheStats reports the tile cache hits and misses.
+func (h *MVTHandler) GetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.mvtService.CacheStats())
+}
@@ -1,41 +1,216 @@
 package mvt
 
 import (
+	"database/sql"
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
 )
 
+// auditColumns are added to every spatial table by the import. They are
+// left out of tiles unless asked for.
+var auditColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"created_by": true,
+	"updated_by": true,
+}
+
 type MVTService struct {
 	db *sqlx.DB
+	// cache is nil when tiles are not cached.
+	cache                 Cache
+	backend               string
+	hits, misses, dropped atomic.Int64
+	// baseURL is the public URL of the server, which TileJSON tile URLs
+	// start with.
+	baseURL string
+}
+
+func NewMVTService(db *sqlx.DB, cache Cache, backend string, baseURL string) *MVTService {
+	if cache == nil {
+		backend = CacheNone
+	}
+	return &MVTService{db: db, cache: cache, backend: backend, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// InvalidateTable drops the cached tiles of tableName. Edits already change
+// the version tiles are cached under; this frees the space of the old ones.
+func (s *MVTService) InvalidateTable(tableName string) {
+	if s.cache == nil {
+		return
+	}
+	s.cache.Invalidate(tableName)
+	s.dropped.Add(1)
+}
+
+// CacheStats returns the tile cache counters since the server started.
+func (s *MVTService) CacheStats() CacheStats {
+	return CacheStats{
+		Backend:       s.backend,
+		Hits:          s.hits.Load(),
+		Misses:        s.misses.Load(),
+		Invalidations: s.dropped.Load(),
+	}
+}
+
+// LastModified returns when the data of tableName last changed.
+func (s *MVTService) LastModified(tableName string) (time.Time, error) {
+	var modified time.Time
+	err := s.db.Get(&modified, "SELECT COALESCE(updated_at, 'epoch') FROM spatial_data WHERE table_name = $1", tableName)
+	if err == sql.ErrNoRows {
+		return time.Time{}, errors.ErrNotFound
+	}
+	return modified, err
+}
+
+// tileTable is a table of the spatial_data catalog that tiles are cut from.
+// UpdatedAt is bumped by every edit of the table, so it versions the cached
+// tiles.
+type tileTable struct {
+	TableName   string    `db:"table_name"`
+	SRID        int       `db:"srid"`
+	HasGeom3857 bool      `db:"has_geom_3857"`
+	UpdatedAt   time.Time `db:"updated_at"`
 }
 
-func NewMVTService(db *sqlx.DB) *MVTService {
-	return &MVTService{db: db}
+const tileTableColumns = "sd.table_name, sd.srid, sd.has_geom_3857, COALESCE(sd.updated_at, 'epoch') AS updated_at"
+
+// GenerateMVT returns the tile z/x/y of tableName. Features carry their id
+// and, as attributes, the columns in fields, or every attribute column when
+// fields is empty.
+func (s *MVTService) GenerateMVT(tableName string, z, x, y int, fields []string) ([]byte, error) {
+	// Only tables in the spatial_data catalog are served.
+	var table tileTable
+	err := s.db.Get(&table, "SELECT "+tileTableColumns+" FROM spatial_data sd WHERE sd.table_name = $1", tableName)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.tableTile(table, tableName, z, x, y, fields)
 }
 
-func (s *MVTService) GenerateMVT(tableName string, z, x, y int) ([]byte, error) {
+// tableTile returns the tile z/x/y of table, with one layer named layerName,
+// from the cache, generating it on a miss.
+func (s *MVTService) tableTile(table tileTable, layerName string, z, x, y int, fields []string) ([]byte, error) {
+	tableName := table.TableName
+	fields = uniqueFields(fields)
+	key := TileKey{Table: tableName, Version: table.UpdatedAt.UnixNano(), Z: z, X: x, Y: y, Fields: strings.Join(fields, ",")}
+	if layerName != tableName {
+		key.Layer = layerName
+	}
+	if s.cache != nil {
+		if tile, ok := s.cache.Get(key); ok {
+			s.hits.Add(1)
+			return tile, nil
+		}
+		s.misses.Add(1)
+	}
+
+	attributes, err := s.attributeColumns(tableName, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// The tile envelope is transformed into the table's SRID so the spatial
+	// index on geom can be used, unless the table keeps a Web Mercator copy
+	// in geom_3857.
+	envelope := fmt.Sprintf("ST_TileEnvelope(%d, %d, %d)", z, x, y)
+	geom := "ST_Transform(geom, 3857)"
+	filter := fmt.Sprintf("ST_Intersects(geom, ST_Transform(%s, %d))", envelope, table.SRID)
+	switch {
+	case table.HasGeom3857:
+		geom = "geom_3857"
+		filter = fmt.Sprintf("ST_Intersects(geom_3857, %s)", envelope)
+	case table.SRID == 3857:
+		geom = "geom"
+		filter = fmt.Sprintf("ST_Intersects(geom, %s)", envelope)
+	}
+
+	columns := "id"
+	for _, name := range attributes {
+		columns += ", " + identifier.Quote(name)
+	}
+
+	// The id becomes the feature id of the tile rather than an attribute.
 	query := fmt.Sprintf(`
 		WITH mvt_geom AS (
-			SELECT ST_AsMVTGeom(
-				ST_Transform(geom, 3857),
-				ST_TileEnvelope(%d, %d, %d)
-			) AS geom,
-			properties
+			SELECT ST_AsMVTGeom(%s, %s) AS geom,
+			%s
 			FROM %s
-			WHERE ST_Intersects(
-				geom,
-				ST_Transform(ST_TileEnvelope(%d, %d, %d), 4326)
-			)
+			WHERE %s
 		)
-		SELECT ST_AsMVT(mvt_geom.*, '%s', 4096, 'geom') FROM mvt_geom;
-	`, z, x, y, tableName, z, x, y, tableName)
+		SELECT ST_AsMVT(mvt_geom.*, $1, 4096, 'geom', 'id') FROM mvt_geom;
+	`, geom, envelope, columns, identifier.Quote(tableName), filter)
 
 	var mvt []byte
-	err := s.db.Get(&mvt, query)
+	err = s.db.Get(&mvt, query, layerName)
 	if err != nil {
 		return nil, err
 	}
 
+	if s.cache != nil {
+		s.cache.Set(key, mvt)
+	}
 	return mvt, nil
-}
\ No newline at end of file
+}
+
+// attributeColumns checks fields against the columns of tableName, or lists
+// its attribute columns when fields is empty.
+func (s *MVTService) attributeColumns(tableName string, fields []string) ([]string, error) {
+	var columns []string
+	err := s.db.Select(&columns, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+		AND column_name NOT IN ('id', 'geom', 'geom_3857')
+		ORDER BY ordinal_position
+	`, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		var attributes []string
+		for _, name := range columns {
+			if !auditColumns[name] {
+				attributes = append(attributes, name)
+			}
+		}
+		return attributes, nil
+	}
+
+	known := make(map[string]bool, len(columns))
+	for _, name := range columns {
+		known[name] = true
+	}
+	for _, name := range fields {
+		if !known[name] {
+			return nil, errors.ErrInvalidInput
+		}
+	}
+	return fields, nil
+}
+
+// uniqueFields trims the requested field names and drops repeated ones,
+// keeping the first of each, so equivalent requests select and cache the
+// same tile.
+func uniqueFields(fields []string) []string {
+	seen := make(map[string]bool, len(fields))
+	unique := make([]string, 0, len(fields))
+	for _, name := range fields {
+		name = strings.TrimSpace(name)
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
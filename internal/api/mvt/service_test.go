@@ -0,0 +1,25 @@
+package mvt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueFields(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   []string
+	}{
+		{nil, []string{}},
+		{[]string{"name"}, []string{"name"}},
+		{[]string{"name", "name"}, []string{"name"}},
+		{[]string{"kode", "name", "kode", " name "}, []string{"kode", "name"}},
+		{[]string{"b", "a", "b"}, []string{"b", "a"}},
+		{[]string{"", "name", ""}, []string{"", "name"}},
+	}
+	for _, tt := range tests {
+		if got := uniqueFields(tt.fields); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uniqueFields(%q) = %q, want %q", tt.fields, got, tt.want)
+		}
+	}
+}
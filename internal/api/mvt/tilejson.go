@@ -0,0 +1,196 @@
+package mvt
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/url"
+
+	"github.com/lib/pq"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+)
+
+// Zoom levels tiles are served at.
+const (
+	minZoom = 0
+	maxZoom = 22
+)
+
+// worldBounds are the bounds of a table without features: the extent of Web
+// Mercator.
+var worldBounds = []float64{-180, -85.0511, 180, 85.0511}
+
+// TileJSON describes a vector tile source, following TileJSON 3.0.0.
+type TileJSON struct {
+	TileJSON     string        `json:"tilejson"`
+	Name         string        `json:"name"`
+	Scheme       string        `json:"scheme"`
+	Tiles        []string      `json:"tiles"`
+	MinZoom      int           `json:"minzoom"`
+	MaxZoom      int           `json:"maxzoom"`
+	Bounds       []float64     `json:"bounds"`
+	Center       []float64     `json:"center"`
+	VectorLayers []VectorLayer `json:"vector_layers"`
+}
+
+// VectorLayer is a layer of the tiles. Fields maps each attribute to its
+// type: Number, String or Boolean.
+type VectorLayer struct {
+	ID      string            `json:"id"`
+	Fields  map[string]string `json:"fields"`
+	MinZoom int               `json:"minzoom"`
+	MaxZoom int               `json:"maxzoom"`
+}
+
+// tileURL returns the tile URL template of path under the public base URL.
+func (s *MVTService) tileURL(path string) string {
+	return s.baseURL + path + "/{z}/{x}/{y}"
+}
+
+// TileJSON describes the tiles of tableName, whose layer holds the default
+// tile attributes.
+func (s *MVTService) TileJSON(tableName string) (*TileJSON, error) {
+	var bbox pq.Float64Array
+	err := s.db.Get(&bbox, "SELECT bbox FROM spatial_data WHERE table_name = $1", tableName)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := s.layerFields([]string{tableName})
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := worldBounds
+	if len(bbox) == 4 {
+		bounds = bbox
+	}
+	return newTileJSON(tableName, s.tileURL("/mvt/"+url.PathEscape(tableName)), bounds,
+		[]VectorLayer{{ID: tableName, Fields: fields[tableName], MinZoom: minZoom, MaxZoom: maxZoom}}), nil
+}
+
+// GroupTileJSON describes the composite tiles of a layer group, with one
+// vector layer per layer of the group.
+func (s *MVTService) GroupTileJSON(groupID int64) (*TileJSON, error) {
+	var groupName string
+	err := s.db.Get(&groupName, "SELECT group_name FROM layer_group WHERE id = $1", groupID)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	groupLayers, err := s.groupLayers(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(groupLayers))
+	for i, layer := range groupLayers {
+		names[i] = layer.TableName
+	}
+	fields, err := s.layerFields(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var bounds []float64
+	layers := make([]VectorLayer, len(groupLayers))
+	for i, layer := range groupLayers {
+		layers[i] = VectorLayer{ID: layer.Name, Fields: fields[layer.TableName], MinZoom: layer.MinZoom, MaxZoom: layer.MaxZoom}
+		if len(layer.BBox) == 4 {
+			bounds = unionBounds(bounds, layer.BBox)
+		}
+	}
+	if bounds == nil {
+		bounds = worldBounds
+	}
+	return newTileJSON(groupName, s.tileURL(fmt.Sprintf("/mvt/group/%d", groupID)), bounds, layers), nil
+}
+
+// layerFields returns the default tile attributes of each table with their
+// TileJSON types.
+func (s *MVTService) layerFields(tableNames []string) (map[string]map[string]string, error) {
+	var columns []struct {
+		TableName string `db:"table_name"`
+		Name      string `db:"column_name"`
+		Type      string `db:"data_type"`
+	}
+	err := s.db.Select(&columns, `
+		SELECT table_name, column_name, data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ANY($1)
+		AND column_name NOT IN ('id', 'geom', 'geom_3857')
+	`, pq.StringArray(tableNames))
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]map[string]string, len(tableNames))
+	for _, name := range tableNames {
+		fields[name] = map[string]string{}
+	}
+	for _, column := range columns {
+		if !auditColumns[column.Name] {
+			fields[column.TableName][column.Name] = fieldType(column.Type)
+		}
+	}
+	return fields, nil
+}
+
+// fieldType maps a Postgres data type to the type of the tile attribute
+// ST_AsMVT writes for it.
+func fieldType(dataType string) string {
+	switch dataType {
+	case "smallint", "integer", "bigint", "numeric", "real", "double precision":
+		return "Number"
+	case "boolean":
+		return "Boolean"
+	default:
+		return "String"
+	}
+}
+
+// newTileJSON returns a TileJSON whose zoom range covers its layers'.
+func newTileJSON(name, tiles string, bounds []float64, layers []VectorLayer) *TileJSON {
+	low, high := minZoom, maxZoom
+	if len(layers) > 0 {
+		low, high = maxZoom, minZoom
+		for _, layer := range layers {
+			low = min(low, layer.MinZoom)
+			high = max(high, layer.MaxZoom)
+		}
+	}
+	return &TileJSON{
+		TileJSON:     "3.0.0",
+		Name:         name,
+		Scheme:       "xyz",
+		Tiles:        []string{tiles},
+		MinZoom:      low,
+		MaxZoom:      high,
+		Bounds:       bounds,
+		Center:       center(bounds, low, high),
+		VectorLayers: layers,
+	}
+}
+
+// center returns the middle of bounds, at the highest zoom between low and
+// high showing all of it on a 512 pixel wide map.
+func center(bounds []float64, low, high int) []float64 {
+	width := math.Max(bounds[2]-bounds[0], bounds[3]-bounds[1])
+	zoom := float64(high)
+	if width > 0 {
+		zoom = math.Min(math.Max(math.Floor(math.Log2(360/width)), float64(low)), float64(high))
+	}
+	return []float64{(bounds[0] + bounds[2]) / 2, (bounds[1] + bounds[3]) / 2, zoom}
+}
+
+func unionBounds(a, b []float64) []float64 {
+	if a == nil {
+		return []float64{b[0], b[1], b[2], b[3]}
+	}
+	return []float64{math.Min(a[0], b[0]), math.Min(a[1], b[1]), math.Max(a[2], b[2]), math.Max(a[3], b[3])}
+}
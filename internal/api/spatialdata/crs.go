@@ -0,0 +1,108 @@
+package spatialdata
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultSRID is the SRID assumed for uploads that do not declare one and the
+// SRID datasets are stored in unless the upload asks for another.
+const defaultSRID = 4326
+
+var (
+	epsgCodePattern  = regexp.MustCompile(`(?i)EPSG:(?:[\d.]*:)?(\d+)$`)
+	authorityPattern = regexp.MustCompile(`(?i)(?:AUTHORITY|ID)\[\s*"EPSG"\s*,\s*"?(\d+)"?\s*\]\s*\]\s*$`)
+	utmZonePattern   = regexp.MustCompile(`(?i)UTM[_ ]zone[_ ](\d{1,2})([NS])`)
+	tm3ZonePattern   = regexp.MustCompile(`(?i)TM[-_ ]?3[_ ]zone[_ ](\d{2})[._](\d)`)
+	crsNamePattern   = regexp.MustCompile(`^\s*(?:PROJCS|GEOGCS|PROJCRS|GEOGCRS)\[\s*"([^"]+)"`)
+)
+
+// sridFromCRSName parses the name of a GeoJSON "crs" member, such as
+// "EPSG:32748", "urn:ogc:def:crs:EPSG::32748" or, with a version,
+// "urn:ogc:def:crs:EPSG:9.8.1:23830". It returns 0 if the name is not
+// recognised.
+func sridFromCRSName(name string) int {
+	name = strings.TrimSpace(name)
+	if strings.HasSuffix(strings.ToUpper(name), "CRS84") {
+		return 4326
+	}
+	if m := epsgCodePattern.FindStringSubmatch(name); m != nil {
+		srid, _ := strconv.Atoi(m[1])
+		return srid
+	}
+	return 0
+}
+
+// sridFromPRJ works out the EPSG code of a shapefile .prj (ESRI WKT). WKT with
+// an EPSG authority is used as is; otherwise the CRS name is matched against
+// the WGS 84 UTM and Indonesian DGN95 TM-3 grids. It returns 0 if the CRS is
+// not recognised.
+func sridFromPRJ(wkt string) int {
+	wkt = strings.TrimSpace(wkt)
+	if m := authorityPattern.FindStringSubmatch(wkt); m != nil {
+		srid, _ := strconv.Atoi(m[1])
+		return srid
+	}
+
+	m := crsNamePattern.FindStringSubmatch(wkt)
+	if m == nil {
+		return 0
+	}
+	name := m[1]
+	upper := strings.ToUpper(name)
+
+	if zone := tm3ZonePattern.FindStringSubmatch(name); zone != nil {
+		return tm3SRID(zone[1], zone[2])
+	}
+
+	if zone := utmZonePattern.FindStringSubmatch(name); zone != nil {
+		number, _ := strconv.Atoi(zone[1])
+		if number < 1 || number > 60 {
+			return 0
+		}
+		switch {
+		case strings.Contains(upper, "WGS_1984"), strings.Contains(upper, "WGS 84"), strings.Contains(upper, "WGS84"):
+			if strings.EqualFold(zone[2], "N") {
+				return 32600 + number
+			}
+			return 32700 + number
+		case strings.Contains(upper, "DGN"):
+			// DGN95 / UTM zones 46N-53N are EPSG:23866-23873, 46S-54S are EPSG:23876-23884.
+			if strings.EqualFold(zone[2], "N") && number >= 46 && number <= 53 {
+				return 23820 + number
+			}
+			if strings.EqualFold(zone[2], "S") && number >= 46 && number <= 54 {
+				return 23830 + number
+			}
+		}
+		return 0
+	}
+
+	switch {
+	case strings.Contains(upper, "WGS_1984_WEB_MERCATOR"), strings.Contains(upper, "PSEUDO-MERCATOR"):
+		return 3857
+	case strings.HasPrefix(wkt, "GEOGCS") && strings.Contains(upper, "WGS_1984"), upper == "WGS 84":
+		return 4326
+	case strings.HasPrefix(wkt, "GEOGCS") && strings.Contains(upper, "DGN"):
+		return 4755
+	}
+
+	return 0
+}
+
+// tm3SRID returns the EPSG code of a DGN95 / Indonesia TM-3 zone such as 48.2.
+// The zones 46.2 to 54.1 are numbered consecutively from EPSG:23830.
+func tm3SRID(zone, half string) int {
+	number, _ := strconv.Atoi(zone)
+	part, _ := strconv.Atoi(half)
+	if part != 1 && part != 2 {
+		return 0
+	}
+
+	index := (number-46)*2 + (part - 1) - 1
+	if index < 0 || index > 15 {
+		return 0
+	}
+	return 23830 + index
+}
@@ -0,0 +1,128 @@
+package spatialdata
+
+import "testing"
+
+func TestSRIDFromCRSName(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"EPSG:32748", 32748},
+		{"epsg:4326", 4326},
+		{"urn:ogc:def:crs:EPSG::32748", 32748},
+		{"urn:ogc:def:crs:EPSG:9.8.1:23830", 23830},
+		{"urn:ogc:def:crs:EPSG:6.6:4326", 4326},
+		{"urn:ogc:def:crs:OGC:1.3:CRS84", 4326},
+		{" EPSG:3857 ", 3857},
+		{"", 0},
+		{"WGS 84", 0},
+		{"EPSG:abc", 0},
+		{"urn:ogc:def:crs:EPSG:9.8.1:", 0},
+	}
+	for _, tt := range tests {
+		if got := sridFromCRSName(tt.name); got != tt.want {
+			t.Errorf("sridFromCRSName(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSRIDFromPRJ(t *testing.T) {
+	tests := []struct {
+		name string
+		wkt  string
+		want int
+	}{
+		{
+			name: "authority",
+			wkt:  `PROJCS["WGS 84 / UTM zone 48S",GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563]],PRIMEM["Greenwich",0],UNIT["degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],UNIT["metre",1],AUTHORITY["EPSG","32748"]]`,
+			want: 32748,
+		},
+		{
+			name: "WKT2 id",
+			wkt:  `GEOGCRS["WGS 84",DATUM["World Geodetic System 1984",ELLIPSOID["WGS 84",6378137,298.257223563]],CS[ellipsoidal,2],ID["EPSG",4326]]`,
+			want: 4326,
+		},
+		{
+			name: "ESRI UTM north",
+			wkt:  `PROJCS["WGS_1984_UTM_Zone_49N",GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]]],PROJECTION["Transverse_Mercator"]]`,
+			want: 32649,
+		},
+		{
+			name: "ESRI UTM south",
+			wkt:  `PROJCS["WGS_1984_UTM_Zone_48S",GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]]],PROJECTION["Transverse_Mercator"]]`,
+			want: 32748,
+		},
+		{
+			name: "UTM zone out of range",
+			wkt:  `PROJCS["WGS_1984_UTM_Zone_61N",GEOGCS["GCS_WGS_1984"]]`,
+			want: 0,
+		},
+		{
+			name: "DGN95 UTM north",
+			wkt:  `PROJCS["DGN_1995_UTM_Zone_50N",GEOGCS["GCS_DGN_1995"]]`,
+			want: 23870,
+		},
+		{
+			name: "DGN95 UTM south",
+			wkt:  `PROJCS["DGN_1995_UTM_Zone_49S",GEOGCS["GCS_DGN_1995"]]`,
+			want: 23879,
+		},
+		{
+			name: "DGN95 TM-3",
+			wkt:  `PROJCS["DGN_1995_Indonesia_TM-3_zone_48.2",GEOGCS["GCS_DGN_1995"]]`,
+			want: 23834,
+		},
+		{
+			name: "web mercator",
+			wkt:  `PROJCS["WGS_1984_Web_Mercator_Auxiliary_Sphere",GEOGCS["GCS_WGS_1984"]]`,
+			want: 3857,
+		},
+		{
+			name: "geographic WGS 84",
+			wkt:  `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]]]`,
+			want: 4326,
+		},
+		{
+			name: "geographic DGN95",
+			wkt:  `GEOGCS["GCS_DGN_1995",DATUM["D_Datum_Geodesi_Nasional_1995"]]`,
+			want: 4755,
+		},
+		{
+			name: "unknown",
+			wkt:  `PROJCS["Lambert_Conformal_Conic",GEOGCS["GCS_North_American_1983"]]`,
+			want: 0,
+		},
+		{
+			name: "not WKT",
+			wkt:  "garbage",
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sridFromPRJ(tt.wkt); got != tt.want {
+				t.Errorf("sridFromPRJ() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTM3SRID(t *testing.T) {
+	tests := []struct {
+		zone, half string
+		want       int
+	}{
+		{"46", "2", 23830},
+		{"47", "1", 23831},
+		{"48", "2", 23834},
+		{"54", "1", 23845},
+		{"46", "1", 0},
+		{"54", "2", 0},
+		{"48", "3", 0},
+	}
+	for _, tt := range tests {
+		if got := tm3SRID(tt.zone, tt.half); got != tt.want {
+			t.Errorf("tm3SRID(%q, %q) = %d, want %d", tt.zone, tt.half, got, tt.want)
+		}
+	}
+}
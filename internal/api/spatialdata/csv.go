@@ -0,0 +1,184 @@
+package spatialdata
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/utils"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// Column names recognised when the upload does not name the geometry columns.
+var (
+	defaultXColumns   = []string{"lon", "lng", "long", "longitude", "x", "bujur"}
+	defaultYColumns   = []string{"lat", "latitude", "y", "lintang"}
+	defaultWKTColumns = []string{"wkt", "geometry", "geom", "the_geom"}
+)
+
+// parseCSV reads a delimited text file whose geometry is either a pair of
+// X/Y columns or a single WKT column. All other columns become properties.
+func parseCSV(file io.Reader, opts UploadOptions, defaultDelimiter rune) (*dataset, error) {
+	if opts.Encoding != "" {
+		enc, err := htmlindex.Get(opts.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("unknown encoding %q", opts.Encoding)
+		}
+		file = transform.NewReader(file, enc.NewDecoder())
+	}
+
+	reader := csv.NewReader(file)
+	reader.Comma = defaultDelimiter
+	if opts.Delimiter != "" {
+		delimiter, err := csvDelimiter(opts.Delimiter)
+		if err != nil {
+			return nil, err
+		}
+		reader.Comma = delimiter
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	xIdx, yIdx, wktIdx, err := csvGeometryColumns(header, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &dataset{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		geom, err := csvGeometry(record, xIdx, yIdx, wktIdx)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if geom == nil {
+			continue
+		}
+
+		feature := geojson.NewFeature(geom)
+		for i, name := range header {
+			if i == xIdx || i == yIdx || i == wktIdx || i >= len(record) || name == "" {
+				continue
+			}
+			if value := utils.ParseTextValue(record[i]); value != nil {
+				feature.Properties[name] = value
+			}
+		}
+		ds.add(line-2, feature)
+	}
+
+	return ds, nil
+}
+
+// csvDelimiter accepts a single character, or "tab" for tab-separated files.
+func csvDelimiter(value string) (rune, error) {
+	switch value {
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, fmt.Errorf("delimiter must be a single character")
+	}
+	r, _ := utf8.DecodeRuneInString(value)
+	return r, nil
+}
+
+// csvGeometryColumns resolves the indexes of the geometry columns, either from
+// the upload options or by recognising common column names. Unused indexes
+// are -1.
+func csvGeometryColumns(header []string, opts UploadOptions) (xIdx, yIdx, wktIdx int, err error) {
+	find := func(names ...string) int {
+		for _, name := range names {
+			for i, col := range header {
+				if strings.EqualFold(strings.TrimSpace(col), name) {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+
+	switch {
+	case opts.WKTColumn != "":
+		if wktIdx = find(opts.WKTColumn); wktIdx < 0 {
+			return -1, -1, -1, fmt.Errorf("column %q not found", opts.WKTColumn)
+		}
+		return -1, -1, wktIdx, nil
+	case opts.XColumn != "" || opts.YColumn != "":
+		xIdx, yIdx = find(opts.XColumn), find(opts.YColumn)
+		if xIdx < 0 || yIdx < 0 {
+			return -1, -1, -1, fmt.Errorf("columns %q and %q are required", opts.XColumn, opts.YColumn)
+		}
+		return xIdx, yIdx, -1, nil
+	}
+
+	xIdx, yIdx = find(defaultXColumns...), find(defaultYColumns...)
+	if xIdx >= 0 && yIdx >= 0 {
+		return xIdx, yIdx, -1, nil
+	}
+	if wktIdx = find(defaultWKTColumns...); wktIdx >= 0 {
+		return -1, -1, wktIdx, nil
+	}
+
+	return -1, -1, -1, fmt.Errorf("no coordinate or WKT column found")
+}
+
+// csvGeometry builds the geometry of one record. Rows with no coordinates
+// return nil so they can be skipped.
+func csvGeometry(record []string, xIdx, yIdx, wktIdx int) (orb.Geometry, error) {
+	field := func(i int) string {
+		if i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	if wktIdx >= 0 {
+		text := field(wktIdx)
+		if text == "" {
+			return nil, nil
+		}
+		// Accept EWKT by dropping the SRID prefix.
+		if i := strings.Index(text, ";"); i >= 0 && strings.HasPrefix(strings.ToUpper(text), "SRID=") {
+			text = text[i+1:]
+		}
+		return wkt.Unmarshal(strings.ToUpper(text))
+	}
+
+	xText, yText := field(xIdx), field(yIdx)
+	if xText == "" && yText == "" {
+		return nil, nil
+	}
+	x, err := strconv.ParseFloat(strings.Replace(xText, ",", ".", 1), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate %q", xText)
+	}
+	y, err := strconv.ParseFloat(strings.Replace(yText, ",", ".", 1), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate %q", yText)
+	}
+
+	return orb.Point{x, y}, nil
+}
@@ -0,0 +1,444 @@
+package spatialdata
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/utils"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
+)
+
+// Limits on the number of features returned by ListFeatures.
+const (
+	defaultFeatureLimit = 100
+	maxFeatureLimit     = 10000
+)
+
+// auditColumns are returned as feature properties but set by the service.
+var auditColumns = []string{"created_at", "updated_at", "created_by", "updated_by"}
+
+// featureTable is what the feature endpoints need to know about a table.
+type featureTable struct {
+	name     string
+	srid     int
+	geomType string
+	columns  []tableColumn
+	// types maps each attribute column to its utils.ConvertToType type.
+	types map[string]string
+}
+
+func loadFeatureTable(q sqlx.Queryer, tableName string) (*featureTable, error) {
+	t := &featureTable{name: tableName}
+	// The column type is read from PostGIS, as the catalog type of tables
+	// imported before it was detected is free text.
+	err := q.QueryRowx(`
+		SELECT s.srid, COALESCE(g.type, 'GEOMETRY') FROM spatial_data s
+		LEFT JOIN geometry_columns g
+			ON g.f_table_schema = current_schema() AND g.f_table_name = s.table_name AND g.f_geometry_column = 'geom'
+		WHERE s.table_name = $1
+	`, tableName).Scan(&t.srid, &t.geomType)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	t.columns, err = tableColumns(q, tableName)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	t.types = make(map[string]string, len(t.columns))
+	for _, col := range t.columns {
+		t.types[col.Name] = postgresColumnType(col.DataType)
+	}
+	return t, nil
+}
+
+// selectSQL selects the table's features in the order scanFeature reads them.
+func (t *featureTable) selectSQL() string {
+	cols := []string{"id", "ST_AsGeoJSON(ST_Transform(geom, 4326))"}
+	for _, col := range t.columns {
+		cols = append(cols, identifier.Quote(col.Name))
+	}
+	cols = append(cols, auditColumns...)
+	return fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), identifier.Quote(t.name))
+}
+
+func (t *featureTable) scanFeature(rows *sqlx.Rows) (*Feature, error) {
+	values := make([]interface{}, 2+len(t.columns)+len(auditColumns))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	feature := &Feature{Type: "Feature", Properties: make(map[string]interface{}, len(values)-2)}
+	feature.ID, _ = values[0].(int64)
+	if geometry, ok := values[1].([]byte); ok {
+		feature.Geometry = json.RawMessage(geometry)
+	} else if geometry, ok := values[1].(string); ok {
+		feature.Geometry = json.RawMessage(geometry)
+	} else {
+		feature.Geometry = json.RawMessage("null")
+	}
+	for i, col := range t.columns {
+		feature.Properties[col.Name] = featureValue(values[2+i], t.types[col.Name])
+	}
+	for i, name := range auditColumns {
+		feature.Properties[name] = featureValue(values[2+len(t.columns)+i], "")
+	}
+	return feature, nil
+}
+
+// featureValue converts a value scanned from the database to its JSON form.
+func featureValue(value interface{}, colType string) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		if colType == "JSONB" {
+			return json.RawMessage(v)
+		}
+		return string(v)
+	case time.Time:
+		if colType == "DATE" {
+			return v.Format("2006-01-02")
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func (s *SpatialDataService) ListFeatures(tableName string, limit, offset int) (*FeatureCollection, error) {
+	if limit <= 0 {
+		limit = defaultFeatureLimit
+	}
+	if limit > maxFeatureLimit || offset < 0 {
+		return nil, errors.ErrInvalidInput
+	}
+
+	t, err := loadFeatureTable(s.db, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Queryx(t.selectSQL()+" ORDER BY id LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	defer rows.Close()
+
+	collection := &FeatureCollection{Type: "FeatureCollection", Features: []Feature{}}
+	for rows.Next() {
+		feature, err := t.scanFeature(rows)
+		if err != nil {
+			return nil, errors.ErrInternalServer
+		}
+		collection.Features = append(collection.Features, *feature)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	return collection, nil
+}
+
+func (s *SpatialDataService) GetFeature(tableName string, id int64) (*Feature, error) {
+	t, err := loadFeatureTable(s.db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return getFeature(s.db, t, id)
+}
+
+func getFeature(q sqlx.Queryer, t *featureTable, id int64) (*Feature, error) {
+	rows, err := q.Queryx(t.selectSQL()+" WHERE id = $1", id)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if rows.Err() != nil {
+			return nil, errors.ErrInternalServer
+		}
+		return nil, errors.ErrNotFound
+	}
+	feature, err := t.scanFeature(rows)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	return feature, nil
+}
+
+// CreateFeature inserts a feature into tableName and returns it as stored.
+func (s *SpatialDataService) CreateFeature(tableName string, input FeatureInput, username string) (*Feature, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	defer tx.Rollback()
+
+	t, err := loadFeatureTable(tx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	geom, err := t.checkGeometry(tx, input)
+	if err != nil {
+		return nil, err
+	}
+	if geom == nil {
+		return nil, errors.ErrInvalidInput
+	}
+	values, err := t.propertyValues(input.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	cols := []string{"geom", "created_by", "updated_by"}
+	placeholders := []string{t.geometrySQL(1), "$2", "$2"}
+	params := []interface{}{string(input.Geometry), username}
+	for _, col := range t.columns {
+		value, ok := values[col.Name]
+		if !ok {
+			continue
+		}
+		params = append(params, value)
+		cols = append(cols, identifier.Quote(col.Name))
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(params)))
+	}
+
+	var id int64
+	err = tx.Get(&id, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING id",
+		identifier.Quote(tableName), strings.Join(cols, ", "), strings.Join(placeholders, ", ")), params...)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	if err := touchCatalog(tx, tableName, username, 1, true); err != nil {
+		return nil, err
+	}
+
+	return s.commitFeature(tx, t, id)
+}
+
+// UpdateFeature changes a feature of tableName. With replace, as for PUT,
+// the geometry is required and properties left out are set to null;
+// otherwise, as for PATCH, only the geometry and properties given change.
+func (s *SpatialDataService) UpdateFeature(tableName string, id int64, input FeatureInput, replace bool, username string) (*Feature, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	defer tx.Rollback()
+
+	t, err := loadFeatureTable(tx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	geom, err := t.checkGeometry(tx, input)
+	if err != nil {
+		return nil, err
+	}
+	if geom == nil && replace {
+		return nil, errors.ErrInvalidInput
+	}
+	values, err := t.propertyValues(input.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := []string{"updated_at = CURRENT_TIMESTAMP", "updated_by = $1"}
+	params := []interface{}{username}
+	if geom != nil {
+		params = append(params, string(input.Geometry))
+		sets = append(sets, "geom = "+t.geometrySQL(len(params)))
+	}
+	for _, col := range t.columns {
+		value, ok := values[col.Name]
+		if !ok && !replace {
+			continue
+		}
+		params = append(params, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", identifier.Quote(col.Name), len(params)))
+	}
+	params = append(params, id)
+
+	res, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE id = $%d",
+		identifier.Quote(tableName), strings.Join(sets, ", "), len(params)), params...)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, errors.ErrNotFound
+	}
+
+	if err := touchCatalog(tx, tableName, username, 0, geom != nil); err != nil {
+		return nil, err
+	}
+
+	return s.commitFeature(tx, t, id)
+}
+
+func (s *SpatialDataService) DeleteFeature(tableName string, id int64, username string) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.Get(&exists, "SELECT EXISTS (SELECT FROM spatial_data WHERE table_name = $1)", tableName)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if !exists {
+		return errors.ErrNotFound
+	}
+
+	res, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = $1", identifier.Quote(tableName)), id)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.ErrNotFound
+	}
+
+	if err := touchCatalog(tx, tableName, username, -1, true); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.ErrInternalServer
+	}
+	s.invalidateTiles(tableName)
+	return nil
+}
+
+// commitFeature reads back feature id and commits tx.
+func (s *SpatialDataService) commitFeature(tx *sqlx.Tx, t *featureTable, id int64) (*Feature, error) {
+	feature, err := getFeature(tx, t, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	s.invalidateTiles(t.name)
+	return feature, nil
+}
+
+// geometrySQL returns the expression storing the GeoJSON geometry in
+// parameter n in the table's SRID and geometry type.
+func (t *featureTable) geometrySQL(n int) string {
+	expr := fmt.Sprintf("ST_Transform(ST_SetSRID(ST_GeomFromGeoJSON($%d), 4326), %d)", n, t.srid)
+	if strings.HasPrefix(t.geomType, "MULTI") {
+		expr = "ST_Multi(" + expr + ")"
+	}
+	return expr
+}
+
+// checkGeometry parses the input's geometry, returning nil if it has none,
+// and checks that it fits the table's geometry type and is valid. Invalid
+// geometries are never repaired here, since the editor can fix them.
+func (t *featureTable) checkGeometry(q sqlx.Queryer, input FeatureInput) (orb.Geometry, error) {
+	if input.Type != "Feature" {
+		return nil, errors.ErrInvalidInput
+	}
+	if len(input.Geometry) == 0 || string(input.Geometry) == "null" {
+		return nil, nil
+	}
+
+	g, err := geojson.UnmarshalGeometry(input.Geometry)
+	if err != nil {
+		return nil, errors.ErrInvalidInput
+	}
+	geom := g.Geometry()
+
+	geomType := strings.ToUpper(geom.GeoJSONType())
+	if t.geomType != "GEOMETRY" && geomType != t.geomType && "MULTI"+geomType != t.geomType {
+		return nil, &GeometryTypeError{TableName: t.name, Expected: t.geomType, Found: []string{geomType}}
+	}
+
+	var reason string
+	err = sqlx.Get(q, &reason, fmt.Sprintf(`
+		SELECT CASE WHEN ST_IsEmpty(g) THEN 'Empty geometry' ELSE ST_IsValidReason(g) END
+		FROM (SELECT %s AS g) input
+	`, t.geometrySQL(1)), string(input.Geometry))
+	if err != nil {
+		return nil, errors.ErrInvalidInput
+	}
+	if reason != "Valid Geometry" {
+		return nil, &InvalidGeometryError{Issues: []GeometryIssue{{TableName: t.name, Reason: reason, Action: ActionRejected}}}
+	}
+
+	return geom, nil
+}
+
+// propertyValues converts the input's properties to the types of the
+// table's columns. Unknown properties are rejected, except the reserved
+// columns, which are ignored.
+func (t *featureTable) propertyValues(properties map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(properties))
+	for name, value := range properties {
+		colType, ok := t.types[name]
+		if !ok {
+			if isReservedColumn(name) {
+				continue
+			}
+			return nil, errors.ErrInvalidInput
+		}
+		if value == nil {
+			values[name] = nil
+			continue
+		}
+		converted, err := utils.ConvertToType(value, colType)
+		if err != nil {
+			return nil, errors.ErrInvalidInput
+		}
+		values[name] = converted
+	}
+	return values, nil
+}
+
+func isReservedColumn(name string) bool {
+	for _, reserved := range identifier.ReservedColumns {
+		if name == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// touchCatalog records a feature edit in the spatial_data catalog: the audit
+// columns, the feature count and the size of the table, and, when a geometry
+// was added, moved or deleted, the bounding box recomputed from the table.
+func touchCatalog(tx *sqlx.Tx, tableName, username string, countDelta int, geomChanged bool) error {
+	_, err := tx.Exec(fmt.Sprintf(`
+		UPDATE spatial_data SET
+			updated_at = CURRENT_TIMESTAMP,
+			updated_by = $2,
+			feature_count = feature_count + $3,
+			bbox = CASE WHEN $4 THEN (
+				SELECT ARRAY[ST_XMin(e), ST_YMin(e), ST_XMax(e), ST_YMax(e)]
+				FROM (SELECT ST_Transform(ST_SetSRID(ST_Extent(geom)::geometry, spatial_data.srid), 4326) AS e FROM %s) extent
+			) ELSE bbox END,
+			size_bytes = pg_total_relation_size(to_regclass(quote_ident($1)))
+		WHERE table_name = $1
+	`, identifier.Quote(tableName)), tableName, username, countDelta, geomChanged)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package spatialdata
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/utils"
+)
+
+// parseGeoJSON reads a FeatureCollection without holding it in memory. A
+// first pass over the file counts the features by geometry family, infers the
+// property types and reads the "crs" member; the features themselves are
+// decoded again, one at a time, when the dataset is imported.
+func parseGeoJSON(file io.ReadSeeker) (*dataset, error) {
+	ds := &dataset{inferredTypes: make(map[string]string), families: make(map[string]int)}
+
+	crsName, err := streamGeoJSON(file, func(_ int, feature *geojson.Feature) error {
+		ds.count++
+		ds.families[geometryFamily(feature.Geometry.GeoJSONType())]++
+		for key, value := range feature.Properties {
+			inferredType := utils.InferPostgresType(value)
+			if existingType, ok := ds.inferredTypes[key]; ok {
+				ds.inferredTypes[key] = utils.ReconcileTypes(existingType, inferredType)
+			} else {
+				ds.inferredTypes[key] = inferredType
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ds.SRID = sridFromCRSName(crsName)
+
+	ds.stream = func(fn func(int, *geojson.Feature) error) error {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := streamGeoJSON(file, fn)
+		return err
+	}
+
+	return ds, nil
+}
+
+// streamGeoJSON calls fn for every feature of a FeatureCollection with its
+// position in the array, skipping features without a geometry, and returns
+// the name of its "crs" member. The crs member was dropped from RFC 7946 but
+// is still written by many tools for projected data.
+func streamGeoJSON(r io.Reader, fn func(position int, feature *geojson.Feature) error) (string, error) {
+	decoder := json.NewDecoder(bufio.NewReaderSize(r, 1<<16))
+
+	if err := expectDelim(decoder, '{'); err != nil {
+		return "", err
+	}
+
+	var crsName string
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		key, _ := token.(string)
+
+		switch key {
+		case "type":
+			var typ string
+			if err := decoder.Decode(&typ); err != nil {
+				return "", err
+			}
+			if typ != "FeatureCollection" {
+				return "", fmt.Errorf("expected a FeatureCollection, got %q", typ)
+			}
+		case "crs":
+			var crs struct {
+				Properties struct {
+					Name string `json:"name"`
+				} `json:"properties"`
+			}
+			if err := decoder.Decode(&crs); err != nil {
+				return "", err
+			}
+			crsName = crs.Properties.Name
+		case "features":
+			if err := expectDelim(decoder, '['); err != nil {
+				return "", err
+			}
+			for index := 0; decoder.More(); index++ {
+				var raw json.RawMessage
+				if err := decoder.Decode(&raw); err != nil {
+					return "", err
+				}
+				feature, err := geojson.UnmarshalFeature(raw)
+				if err != nil {
+					return "", fmt.Errorf("feature %d: %w", index, err)
+				}
+				if feature.Geometry == nil {
+					continue
+				}
+				if err := fn(index, feature); err != nil {
+					return "", err
+				}
+			}
+			if err := expectDelim(decoder, ']'); err != nil {
+				return "", err
+			}
+		default:
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return crsName, expectDelim(decoder, '}')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("invalid GeoJSON: expected %q", delim)
+	}
+	return nil
+}
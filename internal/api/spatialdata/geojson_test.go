@@ -0,0 +1,125 @@
+package spatialdata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestStreamGeoJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		wantPositions []int
+		wantCRS       string
+		wantErr       bool
+	}{
+		{
+			name:          "features",
+			input:         `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{}},{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]},"properties":{}}]}`,
+			wantPositions: []int{0, 1},
+		},
+		{
+			name:          "null geometries are skipped",
+			input:         `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":null,"properties":{}},{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{}},{"type":"Feature","geometry":null,"properties":{}},{"type":"Feature","geometry":{"type":"Point","coordinates":[3,4]},"properties":{}}]}`,
+			wantPositions: []int{1, 3},
+		},
+		{
+			name:          "crs and members in any order",
+			input:         `{"features":[{"type":"Feature","geometry":{"type":"Point","coordinates":[500000,9300000]},"properties":{}}],"name":"x","crs":{"type":"name","properties":{"name":"urn:ogc:def:crs:EPSG::32748"}},"type":"FeatureCollection"}`,
+			wantPositions: []int{0},
+			wantCRS:       "urn:ogc:def:crs:EPSG::32748",
+		},
+		{
+			name:          "empty collection",
+			input:         `{"type":"FeatureCollection","features":[]}`,
+			wantPositions: nil,
+		},
+		{
+			name:    "not a collection",
+			input:   `{"type":"Feature","geometry":null,"properties":{}}`,
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			input:   `[]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid feature",
+			input:   `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":{"type":"Point","coordinates":"x"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			input:   `{"type":"FeatureCollection","features":[{"type":"Feature","geometry":null`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var positions []int
+			crs, err := streamGeoJSON(strings.NewReader(tt.input), func(position int, feature *geojson.Feature) error {
+				positions = append(positions, position)
+				return nil
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(positions, tt.wantPositions) {
+				t.Errorf("positions = %v, want %v", positions, tt.wantPositions)
+			}
+			if crs != tt.wantCRS {
+				t.Errorf("crs = %q, want %q", crs, tt.wantCRS)
+			}
+		})
+	}
+}
+
+func TestParseGeoJSON(t *testing.T) {
+	input := `{"type":"FeatureCollection","crs":{"type":"name","properties":{"name":"EPSG:32748"}},"features":[
+		{"type":"Feature","geometry":{"type":"Point","coordinates":[1,2]},"properties":{"name":"a","count":1}},
+		{"type":"Feature","geometry":null,"properties":{"name":"b"}},
+		{"type":"Feature","geometry":{"type":"LineString","coordinates":[[1,2],[3,4]]},"properties":{"name":"c","count":2.5}}
+	]}`
+
+	ds, err := parseGeoJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.SRID != 32748 {
+		t.Errorf("SRID = %d, want 32748", ds.SRID)
+	}
+	if ds.featureCount() != 2 {
+		t.Errorf("featureCount() = %d, want 2", ds.featureCount())
+	}
+	if want := map[string]int{"POINT": 1, "LINESTRING": 1}; !reflect.DeepEqual(ds.geometryFamilies(), want) {
+		t.Errorf("geometryFamilies() = %v, want %v", ds.geometryFamilies(), want)
+	}
+	if want := map[string]string{"name": "TEXT", "count": "DOUBLE PRECISION"}; !reflect.DeepEqual(ds.propertyTypes(), want) {
+		t.Errorf("propertyTypes() = %v, want %v", ds.propertyTypes(), want)
+	}
+
+	// The features are read from the file again on every pass.
+	for pass := 0; pass < 2; pass++ {
+		var names []string
+		err := ds.forEach(func(_ int, feature *geojson.Feature) error {
+			names = append(names, feature.Properties["name"].(string))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"a", "c"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("pass %d: names = %v, want %v", pass, names, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package spatialdata
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+)
+
+// geometryTypes are the geometry column types a table can be created with.
+// GEOMETRY accepts any geometry.
+var geometryTypes = map[string]bool{
+	"POINT":           true,
+	"LINESTRING":      true,
+	"POLYGON":         true,
+	"MULTIPOINT":      true,
+	"MULTILINESTRING": true,
+	"MULTIPOLYGON":    true,
+	"GEOMETRY":        true,
+}
+
+// GeometryTypeError is returned when the geometries of an upload do not fit
+// the requested type or the type of the table they are loaded into.
+type GeometryTypeError struct {
+	TableName string
+	Expected  string
+	Found     []string
+}
+
+func (e *GeometryTypeError) Error() string {
+	return fmt.Sprintf("%s: expected %s geometries, found %s", e.TableName, e.Expected, strings.Join(e.Found, ", "))
+}
+
+// normalizeGeometryType checks the type form field and returns it in upper
+// case. An empty type means the type is detected from the data.
+func normalizeGeometryType(geomType string) (string, error) {
+	geomType = strings.ToUpper(strings.TrimSpace(geomType))
+	if geomType != "" && !geometryTypes[geomType] {
+		return "", errors.ErrInvalidInput
+	}
+	return geomType, nil
+}
+
+// geometryFamily returns POINT, LINESTRING or POLYGON for the single and
+// multi variants of each, and GEOMETRYCOLLECTION for collections.
+func geometryFamily(geomType string) string {
+	return strings.TrimPrefix(strings.ToUpper(geomType), "MULTI")
+}
+
+// detectGeometryType returns the narrowest column type that holds geometries
+// of the given types: the type itself, its MULTI variant when single and
+// multi geometries are mixed, or GEOMETRY for mixed families. It returns ""
+// when there are no geometries.
+func detectGeometryType(types []string) string {
+	families := make(map[string]bool)
+	multi := false
+	for _, geomType := range types {
+		family := geometryFamily(geomType)
+		if family == "GEOMETRYCOLLECTION" {
+			return "GEOMETRY"
+		}
+		families[family] = true
+		multi = multi || strings.HasPrefix(strings.ToUpper(geomType), "MULTI")
+	}
+
+	switch {
+	case len(families) == 0:
+		return ""
+	case len(families) > 1:
+		return "GEOMETRY"
+	}
+	for family := range families {
+		if multi {
+			return "MULTI" + family
+		}
+		return family
+	}
+	return ""
+}
+
+// resolveGeometryType settles the column type of a new table from the type
+// requested in the upload, the type detected in the data and the type
+// declared by the source format. A requested MULTI type promotes single
+// geometries; any other difference is a *GeometryTypeError.
+func resolveGeometryType(tableName, requested, declared string, found []string) (string, error) {
+	detected := detectGeometryType(found)
+	switch {
+	case detected == "":
+		if requested != "" {
+			return requested, nil
+		}
+		if geometryTypes[strings.ToUpper(declared)] {
+			return strings.ToUpper(declared), nil
+		}
+		return "GEOMETRY", nil
+	case requested == "":
+		return detected, nil
+	case requested == detected || requested == "GEOMETRY" || requested == "MULTI"+detected:
+		return requested, nil
+	default:
+		return "", &GeometryTypeError{TableName: tableName, Expected: requested, Found: found}
+	}
+}
+
+// distinctGeometryTypes lists the geometry types found in table.
+func distinctGeometryTypes(tx *sqlx.Tx, table string) ([]string, error) {
+	var types []string
+	err := tx.Select(&types, fmt.Sprintf("SELECT DISTINCT GeometryType(geom) FROM %s ORDER BY 1", table))
+	return types, err
+}
+
+// enforceGeometryType changes the geom column of a new table to geomType,
+// promoting single geometries when it is a MULTI type.
+func enforceGeometryType(tx *sqlx.Tx, table, geomType string, srid int) error {
+	using := "geom"
+	if strings.HasPrefix(geomType, "MULTI") {
+		using = "ST_Multi(geom)"
+	}
+	_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN geom TYPE GEOMETRY(%s, %d) USING %s", table, geomType, srid, using))
+	return err
+}
+
+// conformStagedGeometries makes the staged geometries fit the geometry type
+// of the table they are loaded into, promoting single geometries for a MULTI
+// column, and returns a *GeometryTypeError if some still do not fit.
+func conformStagedGeometries(tx *sqlx.Tx, staging, tableName, geomType string) error {
+	if geomType == "GEOMETRY" {
+		return nil
+	}
+
+	if strings.HasPrefix(geomType, "MULTI") {
+		_, err := tx.Exec(fmt.Sprintf("UPDATE %s SET geom = ST_Multi(geom) WHERE GeometryType(geom) = $1", staging),
+			strings.TrimPrefix(geomType, "MULTI"))
+		if err != nil {
+			return errors.ErrInternalServer
+		}
+	}
+
+	found, err := distinctGeometryTypes(tx, staging)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	for _, t := range found {
+		if t != geomType {
+			return &GeometryTypeError{TableName: tableName, Expected: geomType, Found: found}
+		}
+	}
+	return nil
+}
+
+// tableGeometryType returns the type of the geom column of tableName, as
+// registered in geometry_columns.
+func tableGeometryType(tx *sqlx.Tx, tableName string) (string, error) {
+	var geomType string
+	err := tx.Get(&geomType, `
+		SELECT type FROM geometry_columns
+		WHERE f_table_schema = current_schema() AND f_table_name = $1 AND f_geometry_column = 'geom'
+	`, tableName)
+	return geomType, err
+}
+
+// geometryFamilies counts the dataset's features by geometry family.
+func (d *dataset) geometryFamilies() map[string]int {
+	if d.stream != nil {
+		return d.families
+	}
+	families := make(map[string]int)
+	for _, feature := range d.Features {
+		families[geometryFamily(feature.Geometry.GeoJSONType())]++
+	}
+	return families
+}
+
+// splitByGeometryFamily returns one dataset per geometry family found in d,
+// or d itself when it holds a single family. The parts share d's columns.
+func (d *dataset) splitByGeometryFamily() []*dataset {
+	families := d.geometryFamilies()
+	if len(families) < 2 {
+		return []*dataset{d}
+	}
+
+	names := make([]string, 0, len(families))
+	for family := range families {
+		names = append(names, family)
+	}
+	sort.Strings(names)
+
+	columnTypes := d.propertyTypes()
+	parts := make([]*dataset, len(names))
+	for i, family := range names {
+		family := family
+		parts[i] = &dataset{
+			Name:         d.Name,
+			GeometryType: family,
+			SRID:         d.SRID,
+			ColumnTypes:  columnTypes,
+			count:        families[family],
+			families:     map[string]int{family: families[family]},
+			stream: func(fn func(int, *geojson.Feature) error) error {
+				return d.forEach(func(position int, feature *geojson.Feature) error {
+					if geometryFamily(feature.Geometry.GeoJSONType()) != family {
+						return nil
+					}
+					return fn(position, feature)
+				})
+			},
+		}
+	}
+	return parts
+}
@@ -0,0 +1,472 @@
+package spatialdata
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
+	_ "modernc.org/sqlite"
+)
+
+// gpkgLayer is a feature table listed in gpkg_geometry_columns.
+type gpkgLayer struct {
+	TableName    string `db:"table_name"`
+	ColumnName   string `db:"column_name"`
+	GeometryType string `db:"geometry_type_name"`
+	// SRID is the EPSG code of the layer's spatial reference system, or 0.
+	SRID int `db:"srid"`
+}
+
+// gpkgColumn describes an attribute column of a GeoPackage feature table.
+type gpkgColumn struct {
+	Name     string
+	Type     string
+	Postgres string
+}
+
+// parseGeoPackage reads the feature tables of an uploaded GeoPackage. layer
+// selects a single table; "*" selects all of them, and an empty layer is only
+// accepted when the file holds exactly one feature table.
+func parseGeoPackage(file io.Reader, layer string) ([]*dataset, error) {
+	tmp, err := os.CreateTemp("", "upload-*.gpkg")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, file)
+	tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	gpkg, err := sqlx.Open("sqlite", "file:"+tmp.Name()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer gpkg.Close()
+
+	var layers []gpkgLayer
+	err = gpkg.Select(&layers, `
+		SELECT gc.table_name, gc.column_name, gc.geometry_type_name,
+			CASE WHEN upper(srs.organization) = 'EPSG' THEN srs.organization_coordsys_id ELSE 0 END AS srid
+		FROM gpkg_geometry_columns gc
+		JOIN gpkg_contents c ON c.table_name = gc.table_name
+		LEFT JOIN gpkg_spatial_ref_sys srs ON srs.srs_id = gc.srs_id
+		WHERE c.data_type = 'features'
+		ORDER BY gc.table_name`)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := layers[:0]
+	for _, l := range layers {
+		if layer == "*" || l.TableName == layer || (layer == "" && len(layers) == 1) {
+			selected = append(selected, l)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("geopackage has no feature table matching %q", layer)
+	}
+
+	datasets := make([]*dataset, 0, len(selected))
+	for _, l := range selected {
+		ds, err := readGeoPackageLayer(gpkg, l)
+		if err != nil {
+			return nil, err
+		}
+		datasets = append(datasets, ds)
+	}
+
+	return datasets, nil
+}
+
+func readGeoPackageLayer(gpkg *sqlx.DB, layer gpkgLayer) (*dataset, error) {
+	columns, err := gpkgColumns(gpkg, layer)
+	if err != nil {
+		return nil, err
+	}
+
+	selectCols := []string{quoteSQLite(layer.ColumnName)}
+	columnTypes := make(map[string]string, len(columns))
+	for _, col := range columns {
+		selectCols = append(selectCols, quoteSQLite(col.Name))
+		columnTypes[col.Name] = col.Postgres
+	}
+
+	rows, err := gpkg.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(selectCols, ", "), quoteSQLite(layer.TableName)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ds := &dataset{
+		Name:         layer.TableName,
+		GeometryType: strings.ToUpper(layer.GeometryType),
+		SRID:         layer.SRID,
+		ColumnTypes:  columnTypes,
+	}
+	values := make([]interface{}, len(selectCols))
+	pointers := make([]interface{}, len(selectCols))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for position := 0; rows.Next(); position++ {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		blob, _ := values[0].([]byte)
+		geom, err := decodeGeoPackageGeometry(blob)
+		if err != nil {
+			return nil, err
+		}
+		if geom == nil {
+			continue
+		}
+
+		feature := geojson.NewFeature(geom)
+		for i, col := range columns {
+			if value := gpkgValue(values[i+1], col.Postgres); value != nil {
+				feature.Properties[col.Name] = value
+			}
+		}
+		ds.add(position, feature)
+	}
+
+	return ds, rows.Err()
+}
+
+// gpkgColumns lists the attribute columns of a feature table, skipping the
+// primary key, the geometry column and BLOBs.
+func gpkgColumns(gpkg *sqlx.DB, layer gpkgLayer) ([]gpkgColumn, error) {
+	rows, err := gpkg.Query(fmt.Sprintf("PRAGMA table_info(%s)", quoteSQLite(layer.TableName)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []gpkgColumn
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		if pk > 0 || name == layer.ColumnName {
+			continue
+		}
+		pgType := gpkgPostgresType(colType)
+		if pgType == "" {
+			continue
+		}
+		columns = append(columns, gpkgColumn{Name: name, Type: colType, Postgres: pgType})
+	}
+
+	return columns, rows.Err()
+}
+
+// gpkgPostgresType maps a GeoPackage column type to a Postgres column type.
+// An empty result means the column is not imported.
+func gpkgPostgresType(colType string) string {
+	colType = strings.ToUpper(colType)
+	if i := strings.IndexByte(colType, '('); i >= 0 {
+		colType = colType[:i]
+	}
+
+	switch strings.TrimSpace(colType) {
+	case "BOOLEAN":
+		return "BOOLEAN"
+	case "TINYINT", "SMALLINT", "MEDIUMINT":
+		return "INTEGER"
+	case "INT", "INTEGER":
+		return "BIGINT"
+	case "FLOAT", "DOUBLE", "REAL":
+		return "DOUBLE PRECISION"
+	case "DATE":
+		return "DATE"
+	case "DATETIME":
+		return "TIMESTAMP WITH TIME ZONE"
+	case "BLOB":
+		return ""
+	default:
+		return "TEXT"
+	}
+}
+
+// gpkgValue converts a value scanned from SQLite to one accepted by
+// utils.ConvertToType for pgType.
+func gpkgValue(value interface{}, pgType string) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case int64:
+		switch pgType {
+		case "BOOLEAN":
+			return v != 0
+		case "DOUBLE PRECISION":
+			return float64(v)
+		default:
+			return fmt.Sprintf("%d", v)
+		}
+	case []byte:
+		return string(v)
+	default:
+		return v
+	}
+}
+
+// decodeGeoPackageGeometry strips the GeoPackage binary header and decodes
+// the WKB that follows. Empty geometries return nil.
+func decodeGeoPackageGeometry(blob []byte) (orb.Geometry, error) {
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	if len(blob) < 8 || blob[0] != 'G' || blob[1] != 'P' {
+		return nil, fmt.Errorf("invalid geopackage geometry header")
+	}
+
+	flags := blob[3]
+	if flags&0x10 != 0 {
+		return nil, nil
+	}
+
+	envelopeSizes := []int{0, 32, 48, 48, 64}
+	envelope := int(flags>>1) & 0x07
+	if envelope >= len(envelopeSizes) {
+		return nil, fmt.Errorf("invalid geopackage envelope indicator %d", envelope)
+	}
+	offset := 8 + envelopeSizes[envelope]
+	if len(blob) < offset {
+		return nil, fmt.Errorf("truncated geopackage geometry")
+	}
+
+	return wkb.Unmarshal(blob[offset:])
+}
+
+// encodeGeoPackageGeometry wraps geom in a GeoPackage binary header with an
+// XY envelope.
+func encodeGeoPackageGeometry(geom orb.Geometry, srid int32) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write([]byte{'G', 'P', 0, 0x01 | 0x02})
+	binary.Write(&buf, binary.LittleEndian, srid)
+
+	bound := geom.Bound()
+	binary.Write(&buf, binary.LittleEndian, []float64{bound.Min[0], bound.Max[0], bound.Min[1], bound.Max[1]})
+
+	data, err := wkb.Marshal(geom, binary.LittleEndian)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+
+	return buf.Bytes(), nil
+}
+
+// sqliteType maps a Postgres data_type from information_schema to the
+// GeoPackage column type used on export.
+func sqliteType(pgType string) string {
+	switch pgType {
+	case "smallint", "integer", "bigint":
+		return "INTEGER"
+	case "real", "double precision", "numeric":
+		return "DOUBLE"
+	case "boolean":
+		return "BOOLEAN"
+	case "date":
+		return "DATE"
+	case "timestamp with time zone", "timestamp without time zone":
+		return "DATETIME"
+	default:
+		return "TEXT"
+	}
+}
+
+// sqliteValue converts a value scanned from Postgres to one SQLite can store.
+func sqliteValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return v
+	}
+}
+
+// gpkgWriter builds a GeoPackage containing a single feature table.
+type gpkgWriter struct {
+	db      *sqlx.DB
+	tx      *sqlx.Tx
+	table   string
+	columns []string
+	insert  *sql.Stmt
+	bound   orb.Bound
+	empty   bool
+}
+
+// newGeoPackageWriter creates the GeoPackage at path with a feature table
+// named table whose attribute columns have the given SQLite types.
+func newGeoPackageWriter(path, table, geometryType string, columns, types []string) (*gpkgWriter, error) {
+	gpkg, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &gpkgWriter{db: gpkg, table: table, columns: columns, empty: true}
+	if err := w.createSchema(geometryType, types); err != nil {
+		gpkg.Close()
+		return nil, err
+	}
+
+	w.tx, err = gpkg.Beginx()
+	if err != nil {
+		gpkg.Close()
+		return nil, err
+	}
+
+	names := []string{"geom"}
+	placeholders := []string{"?"}
+	for _, col := range columns {
+		names = append(names, quoteSQLite(col))
+		placeholders = append(placeholders, "?")
+	}
+	w.insert, err = w.tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteSQLite(table), strings.Join(names, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		w.tx.Rollback()
+		gpkg.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *gpkgWriter) createSchema(geometryType string, types []string) error {
+	statements := []string{
+		"PRAGMA application_id = 1196444487",
+		"PRAGMA user_version = 10200",
+		`CREATE TABLE gpkg_spatial_ref_sys (
+			srs_name TEXT NOT NULL,
+			srs_id INTEGER PRIMARY KEY,
+			organization TEXT NOT NULL,
+			organization_coordsys_id INTEGER NOT NULL,
+			definition TEXT NOT NULL,
+			description TEXT
+		)`,
+		`INSERT INTO gpkg_spatial_ref_sys VALUES
+			('Undefined cartesian SRS', -1, 'NONE', -1, 'undefined', 'undefined cartesian coordinate reference system'),
+			('Undefined geographic SRS', 0, 'NONE', 0, 'undefined', 'undefined geographic coordinate reference system'),
+			('WGS 84 geodetic', 4326, 'EPSG', 4326, 'GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4326"]]', 'longitude/latitude coordinates in decimal degrees on the WGS 84 spheroid')`,
+		`CREATE TABLE gpkg_contents (
+			table_name TEXT NOT NULL PRIMARY KEY,
+			data_type TEXT NOT NULL,
+			identifier TEXT UNIQUE,
+			description TEXT DEFAULT '',
+			last_change DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			min_x DOUBLE,
+			min_y DOUBLE,
+			max_x DOUBLE,
+			max_y DOUBLE,
+			srs_id INTEGER REFERENCES gpkg_spatial_ref_sys(srs_id)
+		)`,
+		`CREATE TABLE gpkg_geometry_columns (
+			table_name TEXT NOT NULL,
+			column_name TEXT NOT NULL,
+			geometry_type_name TEXT NOT NULL,
+			srs_id INTEGER NOT NULL REFERENCES gpkg_spatial_ref_sys(srs_id),
+			z TINYINT NOT NULL,
+			m TINYINT NOT NULL,
+			PRIMARY KEY (table_name, column_name)
+		)`,
+	}
+
+	columnDefs := []string{"fid INTEGER PRIMARY KEY AUTOINCREMENT", "geom " + geometryType}
+	for i, col := range w.columns {
+		columnDefs = append(columnDefs, fmt.Sprintf("%s %s", quoteSQLite(col), types[i]))
+	}
+	statements = append(statements, fmt.Sprintf("CREATE TABLE %s (%s)", quoteSQLite(w.table), strings.Join(columnDefs, ", ")))
+
+	for _, stmt := range statements {
+		if _, err := w.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.db.Exec(`INSERT INTO gpkg_geometry_columns VALUES (?, 'geom', ?, 4326, 0, 0)`, w.table, geometryType)
+	return err
+}
+
+// Write appends a feature. values are in the order of the writer's columns.
+func (w *gpkgWriter) Write(geom orb.Geometry, values []interface{}) error {
+	var blob interface{}
+	if geom != nil {
+		data, err := encodeGeoPackageGeometry(geom, 4326)
+		if err != nil {
+			return err
+		}
+		blob = data
+
+		if w.empty {
+			w.bound = geom.Bound()
+			w.empty = false
+		} else {
+			w.bound = w.bound.Union(geom.Bound())
+		}
+	}
+
+	args := append([]interface{}{blob}, values...)
+	_, err := w.insert.Exec(args...)
+	return err
+}
+
+// Close registers the table in gpkg_contents with its extent and commits.
+func (w *gpkgWriter) Close() error {
+	defer w.db.Close()
+	defer w.insert.Close()
+
+	minX, minY, maxX, maxY := math.NaN(), math.NaN(), math.NaN(), math.NaN()
+	if !w.empty {
+		minX, minY, maxX, maxY = w.bound.Min[0], w.bound.Min[1], w.bound.Max[0], w.bound.Max[1]
+	}
+	extent := []interface{}{nullFloat(minX), nullFloat(minY), nullFloat(maxX), nullFloat(maxY)}
+
+	_, err := w.tx.Exec(`INSERT INTO gpkg_contents (table_name, data_type, identifier, min_x, min_y, max_x, max_y, srs_id)
+		VALUES (?, 'features', ?, ?, ?, ?, ?, 4326)`, append([]interface{}{w.table, w.table}, extent...)...)
+	if err != nil {
+		w.tx.Rollback()
+		return err
+	}
+
+	return w.tx.Commit()
+}
+
+func nullFloat(f float64) interface{} {
+	if math.IsNaN(f) {
+		return nil
+	}
+	return f
+}
+
+// layerTableName derives the Postgres table for a GeoPackage layer imported
+// alongside others under the base table name.
+func layerTableName(base, layer string) string {
+	return identifier.Normalize(base + "_" + layer)
+}
+
+func quoteSQLite(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
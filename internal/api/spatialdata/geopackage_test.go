@@ -0,0 +1,102 @@
+package spatialdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/wkb"
+)
+
+func TestGeoPackageGeometryRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		geom orb.Geometry
+	}{
+		{"point", orb.Point{106.8, -6.2}},
+		{"line string", orb.LineString{{106.8, -6.2}, {106.9, -6.3}, {107, -6.1}}},
+		{"polygon", orb.Polygon{{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}}, {{1, 1}, {2, 1}, {2, 2}, {1, 1}}}},
+		{"multi point", orb.MultiPoint{{1, 2}, {3, 4}}},
+		{"multi polygon", orb.MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}, {{{5, 5}, {6, 5}, {6, 6}, {5, 5}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blob, err := encodeGeoPackageGeometry(tt.geom, 4326)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(blob[:2]) != "GP" {
+				t.Fatalf("magic = %q, want GP", blob[:2])
+			}
+			if srid := int32(binary.LittleEndian.Uint32(blob[4:8])); srid != 4326 {
+				t.Errorf("srid = %d, want 4326", srid)
+			}
+			var envelope [4]float64
+			binary.Read(bytes.NewReader(blob[8:40]), binary.LittleEndian, &envelope)
+			bound := tt.geom.Bound()
+			if want := [4]float64{bound.Min[0], bound.Max[0], bound.Min[1], bound.Max[1]}; envelope != want {
+				t.Errorf("envelope = %v, want %v", envelope, want)
+			}
+
+			got, err := decodeGeoPackageGeometry(blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !orb.Equal(got, tt.geom) {
+				t.Errorf("decoded %v, want %v", got, tt.geom)
+			}
+		})
+	}
+}
+
+func TestDecodeGeoPackageGeometry(t *testing.T) {
+	point := orb.Point{1, 2}
+	data, err := wkb.Marshal(point, binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := func(flags byte, envelope int) []byte {
+		return append([]byte{'G', 'P', 0, flags, 0, 0, 0, 0}, make([]byte, envelope)...)
+	}
+
+	tests := []struct {
+		name    string
+		blob    []byte
+		want    orb.Geometry
+		wantErr bool
+	}{
+		{name: "no envelope", blob: append(header(0x00, 0), data...), want: point},
+		{name: "XYZ envelope", blob: append(header(0x02<<1, 48), data...), want: point},
+		{name: "XYZM envelope", blob: append(header(0x04<<1, 64), data...), want: point},
+		{name: "empty blob", blob: nil, want: nil},
+		{name: "empty geometry flag", blob: append(header(0x10, 0), data...), want: nil},
+		{name: "bad magic", blob: append([]byte{'X', 'P', 0, 0, 0, 0, 0, 0}, data...), wantErr: true},
+		{name: "bad envelope indicator", blob: append(header(0x05<<1, 0), data...), wantErr: true},
+		{name: "truncated envelope", blob: header(0x01<<1, 8), wantErr: true},
+		{name: "short header", blob: []byte{'G', 'P', 0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeGeoPackageGeometry(tt.blob)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decoded %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("decoded %v, want nil", got)
+				}
+				return
+			}
+			if !orb.Equal(got, tt.want) {
+				t.Errorf("decoded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
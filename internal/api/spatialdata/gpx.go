@@ -0,0 +1,197 @@
+package spatialdata
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// GPX layer names, used as the upload's layer option.
+const (
+	gpxWaypoints = "waypoints"
+	gpxRoutes    = "routes"
+	gpxTracks    = "tracks"
+)
+
+type gpxPoint struct {
+	Lat         float64  `xml:"lat,attr"`
+	Lon         float64  `xml:"lon,attr"`
+	Ele         *float64 `xml:"ele"`
+	Time        string   `xml:"time"`
+	Name        string   `xml:"name"`
+	Comment     string   `xml:"cmt"`
+	Description string   `xml:"desc"`
+	Symbol      string   `xml:"sym"`
+	Type        string   `xml:"type"`
+}
+
+type gpxRoute struct {
+	Name        string     `xml:"name"`
+	Comment     string     `xml:"cmt"`
+	Description string     `xml:"desc"`
+	Number      *int64     `xml:"number"`
+	Type        string     `xml:"type"`
+	Points      []gpxPoint `xml:"rtept"`
+}
+
+type gpxTrack struct {
+	Name        string `xml:"name"`
+	Comment     string `xml:"cmt"`
+	Description string `xml:"desc"`
+	Number      *int64 `xml:"number"`
+	Type        string `xml:"type"`
+	Segments    []struct {
+		Points []gpxPoint `xml:"trkpt"`
+	} `xml:"trkseg"`
+}
+
+type gpxFile struct {
+	Waypoints []gpxPoint `xml:"wpt"`
+	Routes    []gpxRoute `xml:"rte"`
+	Tracks    []gpxTrack `xml:"trk"`
+}
+
+// parseGPX reads waypoints, routes and tracks into separate datasets, since
+// they have different geometry types. layer selects which ones are imported
+// in the same way as for GeoPackages.
+func parseGPX(file io.Reader, layer string) ([]*dataset, error) {
+	var gpx gpxFile
+	if err := xml.NewDecoder(file).Decode(&gpx); err != nil {
+		return nil, err
+	}
+
+	var datasets []*dataset
+
+	if len(gpx.Waypoints) > 0 {
+		ds := &dataset{Name: gpxWaypoints, GeometryType: "POINT", SRID: defaultSRID, ColumnTypes: make(map[string]string)}
+		for i, wpt := range gpx.Waypoints {
+			feature := geojson.NewFeature(orb.Point{wpt.Lon, wpt.Lat})
+			ds.setText(feature, "name", wpt.Name)
+			ds.setText(feature, "comment", wpt.Comment)
+			ds.setText(feature, "description", wpt.Description)
+			ds.setText(feature, "symbol", wpt.Symbol)
+			ds.setText(feature, "type", wpt.Type)
+			if wpt.Ele != nil {
+				ds.set(feature, "ele", *wpt.Ele, "DOUBLE PRECISION")
+			}
+			if t, ok := gpxTime(wpt.Time); ok {
+				ds.set(feature, "time", t, "TIMESTAMP WITH TIME ZONE")
+			}
+			ds.add(i, feature)
+		}
+		datasets = append(datasets, ds)
+	}
+
+	if len(gpx.Routes) > 0 {
+		ds := &dataset{Name: gpxRoutes, GeometryType: "LINESTRING", SRID: defaultSRID, ColumnTypes: make(map[string]string)}
+		for i, rte := range gpx.Routes {
+			if len(rte.Points) < 2 {
+				continue
+			}
+			feature := geojson.NewFeature(gpxLine(rte.Points))
+			ds.setText(feature, "name", rte.Name)
+			ds.setText(feature, "comment", rte.Comment)
+			ds.setText(feature, "description", rte.Description)
+			ds.setText(feature, "type", rte.Type)
+			if rte.Number != nil {
+				ds.set(feature, "number", *rte.Number, "BIGINT")
+			}
+			ds.setRange(feature, rte.Points)
+			ds.add(i, feature)
+		}
+		datasets = append(datasets, ds)
+	}
+
+	if len(gpx.Tracks) > 0 {
+		ds := &dataset{Name: gpxTracks, GeometryType: "MULTILINESTRING", SRID: defaultSRID, ColumnTypes: make(map[string]string)}
+		for i, trk := range gpx.Tracks {
+			var lines orb.MultiLineString
+			var points []gpxPoint
+			for _, seg := range trk.Segments {
+				if len(seg.Points) < 2 {
+					continue
+				}
+				lines = append(lines, gpxLine(seg.Points))
+				points = append(points, seg.Points...)
+			}
+			if len(lines) == 0 {
+				continue
+			}
+			feature := geojson.NewFeature(lines)
+			ds.setText(feature, "name", trk.Name)
+			ds.setText(feature, "comment", trk.Comment)
+			ds.setText(feature, "description", trk.Description)
+			ds.setText(feature, "type", trk.Type)
+			if trk.Number != nil {
+				ds.set(feature, "number", *trk.Number, "BIGINT")
+			}
+			ds.setRange(feature, points)
+			ds.add(i, feature)
+		}
+		datasets = append(datasets, ds)
+	}
+
+	return selectDatasets(datasets, layer)
+}
+
+func gpxLine(points []gpxPoint) orb.LineString {
+	line := make(orb.LineString, len(points))
+	for i, p := range points {
+		line[i] = orb.Point{p.Lon, p.Lat}
+	}
+	return line
+}
+
+func gpxTime(text string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(text))
+	return t, err == nil
+}
+
+// set stores a property and declares its column type.
+func (d *dataset) set(feature *geojson.Feature, name string, value interface{}, colType string) {
+	feature.Properties[name] = value
+	d.ColumnTypes[name] = colType
+}
+
+func (d *dataset) setText(feature *geojson.Feature, name, value string) {
+	if value = strings.TrimSpace(value); value != "" {
+		d.set(feature, name, value, "TEXT")
+	}
+}
+
+// setRange summarises the elevation and time of a route or track's points.
+func (d *dataset) setRange(feature *geojson.Feature, points []gpxPoint) {
+	var minEle, maxEle *float64
+	var start, end time.Time
+	for _, p := range points {
+		if p.Ele != nil {
+			if minEle == nil || *p.Ele < *minEle {
+				minEle = p.Ele
+			}
+			if maxEle == nil || *p.Ele > *maxEle {
+				maxEle = p.Ele
+			}
+		}
+		if t, ok := gpxTime(p.Time); ok {
+			if start.IsZero() || t.Before(start) {
+				start = t
+			}
+			if end.IsZero() || t.After(end) {
+				end = t
+			}
+		}
+	}
+
+	if minEle != nil {
+		d.set(feature, "min_ele", *minEle, "DOUBLE PRECISION")
+		d.set(feature, "max_ele", *maxEle, "DOUBLE PRECISION")
+	}
+	if !start.IsZero() {
+		d.set(feature, "start_time", start, "TIMESTAMP WITH TIME ZONE")
+		d.set(feature, "end_time", end, "TIMESTAMP WITH TIME ZONE")
+	}
+}
@@ -1,8 +1,11 @@
 package spatialdata
 
 import (
-	"io"
+	"fmt"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -10,110 +13,363 @@ import (
 )
 
 type SpatialDataHandler struct {
-    spatialDataService *SpatialDataService
+	spatialDataService *SpatialDataService
 }
 
 func NewSpatialDataHandler(spatialDataService *SpatialDataService) *SpatialDataHandler {
-    return &SpatialDataHandler{spatialDataService: spatialDataService}
+	return &SpatialDataHandler{spatialDataService: spatialDataService}
 }
 
 func (h *SpatialDataHandler) CreateSpatialData(c *gin.Context) {
-    var input SpatialDataCreate
-    if err := c.ShouldBindWith(&input, binding.Form); err != nil {
-        c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
-        return
-    }
+	var input SpatialDataCreate
+	if err := c.ShouldBindWith(&input, binding.Form); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
 
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
 
-    file, err := c.FormFile("file")
-    if err != nil {
-        c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
-        return
-    }
+	openedFile, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		return
+	}
+	defer openedFile.Close()
 
-    openedFile, err := file.Open()
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
-        return
-    }
-    defer openedFile.Close()
+	username, exists := c.Get("username")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errors.NewAPIError(errors.ErrUnauthorized))
+		return
+	}
 
-    username, exists := c.Get("username")
-    if !exists {
-        c.JSON(http.StatusUnauthorized, errors.NewAPIError(errors.ErrUnauthorized))
-        return
-    }
+	if input.Async {
+		j, err := h.spatialDataService.EnqueueSpatialData(input, openedFile, file.Filename, username.(string))
+		if err != nil {
+			switch err {
+			case errors.ErrInvalidInput:
+				c.JSON(http.StatusBadRequest, errors.NewAPIError(err))
+			case errors.ErrResourceAlreadyExists:
+				c.JSON(http.StatusConflict, errors.NewAPIError(err))
+			default:
+				c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+			}
+			return
+		}
 
-    err = h.spatialDataService.CreateSpatialData(input, openedFile, username.(string))
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
-        return
-    }
+		c.Header("Location", fmt.Sprintf("/jobs/%d", j.ID))
+		c.JSON(http.StatusAccepted, j)
+		return
+	}
 
-    c.JSON(http.StatusCreated, gin.H{"message": "Spatial data created successfully"})
+	result, err := h.spatialDataService.CreateSpatialData(input, openedFile, file.Filename, username.(string))
+	if err != nil {
+		if invalidGeometry(c, err) {
+			return
+		}
+		switch err {
+		case errors.ErrInvalidInput:
+			c.JSON(http.StatusBadRequest, errors.NewAPIError(err))
+		case errors.ErrResourceAlreadyExists:
+			c.JSON(http.StatusConflict, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":         "Spatial data created successfully",
+		"table_names":     result.TableNames,
+		"geometry_issues": result.GeometryIssues,
+	})
+}
+
+// invalidGeometry responds with the details of an *InvalidGeometryError or a
+// *GeometryTypeError, and reports whether err was one.
+func invalidGeometry(c *gin.Context, err error) bool {
+	switch geomErr := err.(type) {
+	case *InvalidGeometryError:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"type":            "INVALID_GEOMETRY",
+			"message":         geomErr.Error(),
+			"geometry_issues": geomErr.Issues,
+		})
+	case *GeometryTypeError:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"type":           "GEOMETRY_TYPE_MISMATCH",
+			"message":        geomErr.Error(),
+			"expected":       geomErr.Expected,
+			"geometry_types": geomErr.Found,
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+func (h *SpatialDataHandler) PreviewSpatialData(c *gin.Context) {
+	var input UploadOptions
+	if err := c.ShouldBindWith(&input, binding.Form); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	openedFile, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		return
+	}
+	defer openedFile.Close()
+
+	report, err := h.spatialDataService.PreviewSpatialData(input, openedFile, file.Filename)
+	if err != nil {
+		switch err {
+		case errors.ErrInvalidInput:
+			c.JSON(http.StatusBadRequest, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
 }
 
 func (h *SpatialDataHandler) GetSpatialDataList(c *gin.Context) {
-    spatialDataList, err := h.spatialDataService.GetSpatialDataList()
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
-        return
-    }
+	spatialDataList, err := h.spatialDataService.GetSpatialDataList()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, spatialDataList)
+}
+
+func (h *SpatialDataHandler) GetSpatialData(c *gin.Context) {
+	tableName := c.Param("table_name")
 
-    c.JSON(http.StatusOK, spatialDataList)
+	spatialData, err := h.spatialDataService.GetSpatialData(tableName)
+	if err != nil {
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, spatialData)
+}
+
+func (h *SpatialDataHandler) ExportGeoPackage(c *gin.Context) {
+	tableName := c.Param("table_name")
+
+	path, err := h.spatialDataService.ExportGeoPackage(tableName)
+	if err != nil {
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+	defer os.Remove(path)
+
+	c.Header("Content-Type", "application/geopackage+sqlite3")
+	c.FileAttachment(path, tableName+".gpkg")
 }
 
 func (h *SpatialDataHandler) DeleteSpatialData(c *gin.Context) {
-    tableName := c.Param("table_name")
+	tableName := c.Param("table_name")
 
-    err := h.spatialDataService.DeleteSpatialData(tableName)
-    if err != nil {
-        switch err {
-        case errors.ErrNotFound:
-            c.JSON(http.StatusNotFound, errors.NewAPIError(err))
-        default:
-            c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
-        }
-        return
-    }
+	err := h.spatialDataService.DeleteSpatialData(tableName)
+	if err != nil {
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
 
-    c.JSON(http.StatusOK, gin.H{"message": "Spatial data deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Spatial data deleted successfully"})
 }
 
 func (h *SpatialDataHandler) EditSpatialData(c *gin.Context) {
-    var input SpatialDataEdit
-    if err := c.ShouldBind(&input); err != nil {
-        c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
-        return
-    }
-
-    oldTableName := c.Param("table_name")
-    username, _ := c.Get("username")
-
-    var file io.Reader
-    uploadedFile, err := c.FormFile("file")
-    if err == nil {
-        openedFile, err := uploadedFile.Open()
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, errors.NewAPIError(errors.ErrInternalServer))
-            return
-        }
-        defer openedFile.Close()
-        file = openedFile
-    }
-
-    err = h.spatialDataService.EditSpatialData(oldTableName, input, file, username.(string))
-    if err != nil {
-        switch err {
-        case errors.ErrNotFound:
-            c.JSON(http.StatusNotFound, errors.NewAPIError(err))
-        case errors.ErrInvalidInput:
-            c.JSON(http.StatusBadRequest, errors.NewAPIError(err))
-        default:
-            c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
-        }
-        return
-    }
-
-    c.JSON(http.StatusOK, gin.H{"message": "Spatial data updated successfully"})
+	var input SpatialDataEdit
+	if err := c.ShouldBind(&input); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	oldTableName := c.Param("table_name")
+	username, _ := c.Get("username")
+
+	var file multipart.File
+	var filename string
+	uploadedFile, err := c.FormFile("file")
+	if err == nil {
+		openedFile, err := uploadedFile.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(errors.ErrInternalServer))
+			return
+		}
+		defer openedFile.Close()
+		file = openedFile
+		filename = uploadedFile.Filename
+	}
+
+	result, err := h.spatialDataService.EditSpatialData(oldTableName, input, file, filename, username.(string))
+	if err != nil {
+		if invalidGeometry(c, err) {
+			return
+		}
+		switch err {
+		case errors.ErrNotFound:
+			c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+		case errors.ErrInvalidInput:
+			c.JSON(http.StatusBadRequest, errors.NewAPIError(err))
+		case errors.ErrResourceAlreadyExists:
+			c.JSON(http.StatusConflict, errors.NewAPIError(err))
+		default:
+			c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Spatial data updated successfully",
+		"inserted":        result.Inserted,
+		"updated":         result.Updated,
+		"unchanged":       result.Unchanged,
+		"geometry_issues": result.GeometryIssues,
+	})
+}
+
+func (h *SpatialDataHandler) ListFeatures(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	collection, err := h.spatialDataService.ListFeatures(c.Param("table_name"), limit, offset)
+	if err != nil {
+		featureError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+func (h *SpatialDataHandler) GetFeature(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	feature, err := h.spatialDataService.GetFeature(c.Param("table_name"), id)
+	if err != nil {
+		featureError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, feature)
+}
+
+func (h *SpatialDataHandler) CreateFeature(c *gin.Context) {
+	var input FeatureInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	username, _ := c.Get("username")
+
+	feature, err := h.spatialDataService.CreateFeature(c.Param("table_name"), input, username.(string))
+	if err != nil {
+		featureError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, feature)
+}
+
+// UpdateFeature handles both PUT, which replaces the feature, and PATCH,
+// which changes only what the request contains.
+func (h *SpatialDataHandler) UpdateFeature(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	var input FeatureInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	username, _ := c.Get("username")
+	replace := c.Request.Method == http.MethodPut
+
+	feature, err := h.spatialDataService.UpdateFeature(c.Param("table_name"), id, input, replace, username.(string))
+	if err != nil {
+		featureError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, feature)
+}
+
+func (h *SpatialDataHandler) DeleteFeature(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(errors.ErrInvalidInput))
+		return
+	}
+
+	username, _ := c.Get("username")
+
+	if err := h.spatialDataService.DeleteFeature(c.Param("table_name"), id, username.(string)); err != nil {
+		featureError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feature deleted successfully"})
+}
+
+// featureError responds with the status matching an error of the feature
+// endpoints.
+func featureError(c *gin.Context, err error) {
+	if invalidGeometry(c, err) {
+		return
+	}
+	switch err {
+	case errors.ErrNotFound:
+		c.JSON(http.StatusNotFound, errors.NewAPIError(err))
+	case errors.ErrInvalidInput:
+		c.JSON(http.StatusBadRequest, errors.NewAPIError(err))
+	default:
+		c.JSON(http.StatusInternalServerError, errors.NewAPIError(err))
+	}
 }
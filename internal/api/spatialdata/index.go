@@ -0,0 +1,37 @@
+package spatialdata
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
+)
+
+// indexTable creates the spatial index of a newly imported table and, when
+// withGeom3857 is set, a geom_3857 column holding the geometry in Web
+// Mercator with its own index, so tiles can be cut without reprojecting every
+// row. geom_3857 is generated from geom, so it stays current as features are
+// edited. The table is analyzed last so the planner sees the new data.
+func indexTable(tx *sqlx.Tx, tableName, geomType string, withGeom3857 bool) error {
+	table := identifier.Quote(tableName)
+
+	if _, err := tx.Exec(fmt.Sprintf("CREATE INDEX ON %s USING GIST (geom)", table)); err != nil {
+		return err
+	}
+
+	if withGeom3857 {
+		_, err := tx.Exec(fmt.Sprintf(`
+			ALTER TABLE %s ADD COLUMN geom_3857 GEOMETRY(%s, 3857)
+				GENERATED ALWAYS AS (ST_Transform(geom, 3857)) STORED
+		`, table, geomType))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("CREATE INDEX ON %s USING GIST (geom_3857)", table)); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(fmt.Sprintf("ANALYZE %s", table))
+	return err
+}
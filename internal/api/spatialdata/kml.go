@@ -0,0 +1,308 @@
+package spatialdata
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/utils"
+)
+
+type kmlCoordinates struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPolygon struct {
+	Outer kmlCoordinates   `xml:"outerBoundaryIs>LinearRing"`
+	Inner []kmlCoordinates `xml:"innerBoundaryIs>LinearRing"`
+}
+
+// kmlGeometry holds the geometry elements of a Placemark or MultiGeometry.
+type kmlGeometry struct {
+	Point         []kmlCoordinates `xml:"Point"`
+	LineString    []kmlCoordinates `xml:"LineString"`
+	LinearRing    []kmlCoordinates `xml:"LinearRing"`
+	Polygon       []kmlPolygon     `xml:"Polygon"`
+	MultiGeometry []kmlGeometry    `xml:"MultiGeometry"`
+}
+
+type kmlPlacemark struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	kmlGeometry
+	ExtendedData struct {
+		Data []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value"`
+		} `xml:"Data"`
+		SchemaData []struct {
+			SimpleData []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"SimpleData"`
+		} `xml:"SchemaData"`
+	} `xml:"ExtendedData"`
+}
+
+type kmlSchema struct {
+	SimpleField []struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"SimpleField"`
+}
+
+// parseKMZ reads the main KML document of a KMZ archive: doc.kml if present,
+// otherwise the first .kml file at the root.
+func parseKMZ(r io.ReaderAt, size int64) (*dataset, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc *zip.File
+	for _, f := range archive.File {
+		if strings.ToLower(path.Ext(f.Name)) != ".kml" {
+			continue
+		}
+		if strings.EqualFold(f.Name, "doc.kml") {
+			doc = f
+			break
+		}
+		if doc == nil || (strings.Contains(doc.Name, "/") && !strings.Contains(f.Name, "/")) {
+			doc = f
+		}
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("archive does not contain a .kml file")
+	}
+
+	rc, err := doc.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return parseKML(rc)
+}
+
+// parseKML reads every Placemark in a KML document, wherever it is nested.
+// ExtendedData values become properties; SimpleField types declared in a
+// Schema are used as column types.
+func parseKML(file io.Reader) (*dataset, error) {
+	decoder := xml.NewDecoder(file)
+	ds := &dataset{ColumnTypes: make(map[string]string)}
+	placemarks := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "Schema":
+			var schema kmlSchema
+			if err := decoder.DecodeElement(&schema, &start); err != nil {
+				return nil, err
+			}
+			for _, field := range schema.SimpleField {
+				if colType := kmlColumnType(field.Type); colType != "" {
+					ds.ColumnTypes[field.Name] = colType
+				}
+			}
+		case "Placemark":
+			var placemark kmlPlacemark
+			if err := decoder.DecodeElement(&placemark, &start); err != nil {
+				return nil, err
+			}
+			feature, err := placemark.feature(ds.ColumnTypes)
+			if err != nil {
+				return nil, err
+			}
+			if feature != nil {
+				ds.add(placemarks, feature)
+			}
+			placemarks++
+		}
+	}
+
+	return ds, nil
+}
+
+// kmlColumnType maps a KML SimpleField type to a Postgres column type.
+func kmlColumnType(fieldType string) string {
+	switch fieldType {
+	case "int", "uint", "short", "ushort":
+		return "BIGINT"
+	case "float", "double":
+		return "DOUBLE PRECISION"
+	case "bool":
+		return "BOOLEAN"
+	case "string":
+		return "TEXT"
+	default:
+		return ""
+	}
+}
+
+// feature converts the placemark. Values of columns with a declared type are
+// kept as text for utils.ConvertToType; the rest go through type inference.
+func (p *kmlPlacemark) feature(columnTypes map[string]string) (*geojson.Feature, error) {
+	geom, err := p.kmlGeometry.geometry()
+	if err != nil {
+		return nil, err
+	}
+	if geom == nil {
+		return nil, nil
+	}
+
+	feature := geojson.NewFeature(geom)
+	if name := strings.TrimSpace(p.Name); name != "" {
+		feature.Properties["name"] = name
+	}
+	if description := strings.TrimSpace(p.Description); description != "" {
+		feature.Properties["description"] = description
+	}
+	setValue := func(name, text string) {
+		if _, declared := columnTypes[name]; declared {
+			if text = strings.TrimSpace(text); text != "" {
+				feature.Properties[name] = text
+			}
+		} else if value := utils.ParseTextValue(text); value != nil {
+			feature.Properties[name] = value
+		}
+	}
+	for _, data := range p.ExtendedData.Data {
+		setValue(data.Name, data.Value)
+	}
+	for _, schemaData := range p.ExtendedData.SchemaData {
+		for _, data := range schemaData.SimpleData {
+			setValue(data.Name, data.Value)
+		}
+	}
+
+	return feature, nil
+}
+
+// geometry flattens the KML geometries into one orb geometry: a single
+// geometry as is, several of the same kind as a Multi*, otherwise a collection.
+func (g *kmlGeometry) geometry() (orb.Geometry, error) {
+	var geoms []orb.Geometry
+	if err := g.collect(&geoms); err != nil {
+		return nil, err
+	}
+
+	switch len(geoms) {
+	case 0:
+		return nil, nil
+	case 1:
+		return geoms[0], nil
+	}
+
+	var points orb.MultiPoint
+	var lines orb.MultiLineString
+	var polygons orb.MultiPolygon
+	for _, geom := range geoms {
+		switch v := geom.(type) {
+		case orb.Point:
+			points = append(points, v)
+		case orb.LineString:
+			lines = append(lines, v)
+		case orb.Polygon:
+			polygons = append(polygons, v)
+		}
+	}
+
+	switch len(geoms) {
+	case len(points):
+		return points, nil
+	case len(lines):
+		return lines, nil
+	case len(polygons):
+		return polygons, nil
+	default:
+		return orb.Collection(geoms), nil
+	}
+}
+
+func (g *kmlGeometry) collect(geoms *[]orb.Geometry) error {
+	for _, point := range g.Point {
+		coords, err := parseKMLCoordinates(point.Coordinates)
+		if err != nil {
+			return err
+		}
+		if len(coords) > 0 {
+			*geoms = append(*geoms, coords[0])
+		}
+	}
+	for _, line := range g.LineString {
+		coords, err := parseKMLCoordinates(line.Coordinates)
+		if err != nil {
+			return err
+		}
+		*geoms = append(*geoms, orb.LineString(coords))
+	}
+	for _, ring := range g.LinearRing {
+		coords, err := parseKMLCoordinates(ring.Coordinates)
+		if err != nil {
+			return err
+		}
+		*geoms = append(*geoms, orb.Polygon{orb.Ring(coords)})
+	}
+	for _, polygon := range g.Polygon {
+		outer, err := parseKMLCoordinates(polygon.Outer.Coordinates)
+		if err != nil {
+			return err
+		}
+		poly := orb.Polygon{orb.Ring(outer)}
+		for _, inner := range polygon.Inner {
+			hole, err := parseKMLCoordinates(inner.Coordinates)
+			if err != nil {
+				return err
+			}
+			poly = append(poly, orb.Ring(hole))
+		}
+		*geoms = append(*geoms, poly)
+	}
+	for _, multi := range g.MultiGeometry {
+		if err := multi.collect(geoms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseKMLCoordinates parses whitespace separated "lon,lat[,alt]" tuples.
+func parseKMLCoordinates(text string) ([]orb.Point, error) {
+	var points []orb.Point
+	for _, tuple := range strings.Fields(text) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid KML coordinate %q", tuple)
+		}
+		lon, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KML coordinate %q", tuple)
+		}
+		lat, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KML coordinate %q", tuple)
+		}
+		points = append(points, orb.Point{lon, lat})
+	}
+	return points, nil
+}
@@ -0,0 +1,61 @@
+package spatialdata
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
+)
+
+// Column is an attribute column in a spatial data table's metadata.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Columns is the column list of a spatial data table, stored as JSONB in the
+// spatial_data catalog.
+type Columns []Column
+
+func (c *Columns) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("cannot scan %T into Columns", src)
+	}
+}
+
+func (c Columns) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+// refreshMetadata recomputes the feature count, WGS 84 bounding box, column
+// list and on-disk size of tableName in the spatial_data catalog. It is
+// called after every import and edit, in the same transaction.
+func refreshMetadata(q sqlx.Execer, tableName string) error {
+	_, err := q.Exec(fmt.Sprintf(`
+		UPDATE spatial_data SET
+			feature_count = (SELECT count(*) FROM %[1]s),
+			bbox = (
+				SELECT ARRAY[ST_XMin(e), ST_YMin(e), ST_XMax(e), ST_YMax(e)]
+				FROM (SELECT ST_Transform(ST_SetSRID(ST_Extent(geom)::geometry, spatial_data.srid), 4326) AS e FROM %[1]s) extent
+			),
+			columns = (
+				SELECT COALESCE(jsonb_agg(jsonb_build_object('name', column_name, 'type', upper(data_type)) ORDER BY ordinal_position), '[]')
+				FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = $1 AND column_name <> ALL ($2)
+			),
+			size_bytes = pg_total_relation_size(to_regclass(quote_ident($1)))
+		WHERE table_name = $1
+	`, identifier.Quote(tableName)), tableName, pq.StringArray(identifier.ReservedColumns))
+	return err
+}
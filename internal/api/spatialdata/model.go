@@ -1,22 +1,167 @@
 package spatialdata
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
 
 type SpatialDataCreate struct {
-    TableName string `form:"table_name" binding:"required"`
-    Type      string `form:"type" binding:"required"`
+	TableName string `form:"table_name" binding:"required"`
+	// Type is the geometry type of the table, such as POLYGON or
+	// MULTIPOLYGON. It is detected from the data when empty; when given, the
+	// data must match it.
+	Type string `form:"type"`
+	// Async queues the import as a job instead of running it in the request.
+	Async bool `form:"async"`
+	UploadOptions
+}
+
+// UploadOptions are the form fields that control how an uploaded file is parsed.
+type UploadOptions struct {
+	// Layer selects the feature table of a GeoPackage; "*" imports every table.
+	Layer string `form:"layer"`
+
+	// CSV options. The geometry is read from XColumn/YColumn or WKTColumn;
+	// when none is given, common names such as lon/lat or wkt are tried.
+	XColumn   string `form:"x_column"`
+	YColumn   string `form:"y_column"`
+	WKTColumn string `form:"wkt_column"`
+	Delimiter string `form:"delimiter"`
+	Encoding  string `form:"encoding"`
+
+	// SourceSRID overrides the coordinate system detected in the file.
+	// TargetSRID is the SRID the table is stored in; it defaults to 4326.
+	SourceSRID int `form:"source_srid"`
+	TargetSRID int `form:"target_srid"`
+
+	// ColumnTypes is a JSON object overriding the inferred type of columns,
+	// e.g. {"kode": "TEXT"}, usually after checking POST /spatial-data/preview.
+	ColumnTypes string `form:"column_types"`
+
+	// InvalidGeometry is what happens to features whose geometry is not valid
+	// in PostGIS: InvalidGeometryRepair (the default), InvalidGeometryReject
+	// or InvalidGeometrySkip. Empty geometries are always left out.
+	InvalidGeometry string `form:"invalid_geometry"`
+
+	// SplitGeometryTypes imports a layer holding several geometry families
+	// into one table per family, named <table>_point, <table>_linestring and
+	// <table>_polygon. Without it such a layer gets a GEOMETRY column.
+	SplitGeometryTypes bool `form:"split_geometry_types"`
 }
 
 type SpatialData struct {
-    ID        int64     `db:"id" json:"id"`
-    TableName string    `db:"table_name" json:"table_name"`
-    Type      string    `db:"type" json:"type"`
-    CreatedAt time.Time `db:"created_at" json:"created_at"`
-    UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
-    CreatedBy string     `db:"created_by" json:"created_by"`
-    UpdatedBy string    `db:"updated_by" json:"updated_by"`
+	ID          int64  `db:"id" json:"id"`
+	TableName   string `db:"table_name" json:"table_name"`
+	Type        string `db:"type" json:"type"`
+	SRID        int64  `db:"srid" json:"srid"`
+	SourceSRID  *int64 `db:"source_srid" json:"source_srid"`
+	HasGeom3857 bool   `db:"has_geom_3857" json:"has_geom_3857"`
+	// FeatureCount, BBox, Columns and SizeBytes are refreshed on every import
+	// and edit. BBox is [min lon, min lat, max lon, max lat] in WGS 84 and is
+	// null for an empty table.
+	FeatureCount *int64          `db:"feature_count" json:"feature_count"`
+	BBox         pq.Float64Array `db:"bbox" json:"bbox"`
+	Columns      Columns         `db:"columns" json:"columns"`
+	SizeBytes    *int64          `db:"size_bytes" json:"size_bytes"`
+	CreatedAt    time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time       `db:"updated_at" json:"updated_at"`
+	CreatedBy    string          `db:"created_by" json:"created_by"`
+	UpdatedBy    string          `db:"updated_by" json:"updated_by"`
 }
 
 type SpatialDataEdit struct {
-    TableName *string `json:"table_name"`
-}
\ No newline at end of file
+	TableName *string `json:"table_name" form:"table_name"`
+	// Mode is how an uploaded file is loaded: ModeReplace (the default),
+	// ModeAppend or ModeUpsert.
+	Mode string `form:"mode"`
+	// KeyColumn is the column matched on in ModeUpsert.
+	KeyColumn string `form:"key_column"`
+	UploadOptions
+}
+
+// Modes of loading a file into an existing spatial data table.
+const (
+	ModeReplace = "replace"
+	ModeAppend  = "append"
+	ModeUpsert  = "upsert"
+)
+
+// ImportResult is the outcome of a successful upload.
+type ImportResult struct {
+	TableNames []string `json:"table_names"`
+	// GeometryIssues lists the features whose geometry was repaired or left
+	// out, so that the source file can be fixed.
+	GeometryIssues []GeometryIssue `json:"geometry_issues"`
+}
+
+// EditResult counts the features of an uploaded file by what happened to them.
+type EditResult struct {
+	Inserted       int64           `json:"inserted"`
+	Updated        int64           `json:"updated"`
+	Unchanged      int64           `json:"unchanged"`
+	GeometryIssues []GeometryIssue `json:"geometry_issues"`
+}
+
+// PreviewReport describes what an upload would import, one entry per layer.
+type PreviewReport struct {
+	Layers []LayerPreview `json:"layers"`
+}
+
+type LayerPreview struct {
+	Name          string         `json:"name,omitempty"`
+	FeatureCount  int            `json:"feature_count"`
+	GeometryTypes map[string]int `json:"geometry_types"`
+	// GeometryType is the column type the import would detect.
+	GeometryType string `json:"geometry_type"`
+	// BBox is [min x, min y, max x, max y] in the source CRS.
+	BBox []float64 `json:"bbox"`
+	// DetectedSRID is the CRS found in the file, 0 if none; SRID is the one
+	// the import would use.
+	DetectedSRID int             `json:"detected_srid"`
+	SRID         int             `json:"srid"`
+	Columns      []ColumnPreview `json:"columns"`
+	ProblemCount int             `json:"problem_count"`
+	Problems     []Problem       `json:"problems"`
+}
+
+// ColumnPreview is a column the import would create from a property.
+type ColumnPreview struct {
+	Property  string `json:"property"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	NullCount int    `json:"null_count"`
+}
+
+// Problem is an invalid geometry or a value that cannot be converted to its
+// column type. Feature is the zero-based position of the feature in the
+// layer, counting the features without a geometry that are not imported.
+type Problem struct {
+	Feature int    `json:"feature"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Feature is a row of a spatial data table as a GeoJSON Feature. The geometry
+// is in WGS 84, and the properties include the audit columns.
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         int64                  `json:"id"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// FeatureInput is a GeoJSON Feature sent to create or change a feature. The
+// geometry is in WGS 84. Properties named after id, geom or the audit columns
+// are ignored, so a Feature read from the API can be sent back as is.
+type FeatureInput struct {
+	Type       string                 `json:"type"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
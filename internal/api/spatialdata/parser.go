@@ -0,0 +1,222 @@
+package spatialdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/utils"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
+)
+
+// dataset is the result of parsing an uploaded file, independent of its format.
+type dataset struct {
+	// Name is the source layer name for formats that hold several layers.
+	Name string
+	// GeometryType is the geometry type declared by the source, if any.
+	GeometryType string
+	// SRID is the coordinate system detected in the source, or 0 if unknown.
+	SRID     int
+	Features []*geojson.Feature
+	// Positions holds the zero-based position in the source of each of
+	// Features, which differs from its index once features without a
+	// geometry are left out. It may be nil if none were.
+	Positions []int
+	// ColumnTypes holds the Postgres types declared by the source format
+	// (e.g. DBF field definitions). Columns not listed here are inferred.
+	ColumnTypes map[string]string
+
+	// stream, when set, reads the features from the file again instead of
+	// Features, for formats that are not loaded into memory. count,
+	// inferredTypes and families are then filled in by the parser.
+	stream        func(fn func(position int, feature *geojson.Feature) error) error
+	count         int
+	inferredTypes map[string]string
+	families      map[string]int
+}
+
+// add appends a feature read at position in the source.
+func (d *dataset) add(position int, feature *geojson.Feature) {
+	d.Features = append(d.Features, feature)
+	d.Positions = append(d.Positions, position)
+}
+
+// forEach calls fn for every feature of the dataset with its position in the
+// source.
+func (d *dataset) forEach(fn func(position int, feature *geojson.Feature) error) error {
+	if d.stream != nil {
+		return d.stream(fn)
+	}
+	for i, feature := range d.Features {
+		position := i
+		if d.Positions != nil {
+			position = d.Positions[i]
+		}
+		if err := fn(position, feature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// featureCount returns the number of features in the dataset.
+func (d *dataset) featureCount() int {
+	if d.stream != nil {
+		return d.count
+	}
+	return len(d.Features)
+}
+
+// parseUpload detects the format of an uploaded file and parses it into one
+// dataset per imported layer, applying the upload's column type overrides.
+func parseUpload(file multipart.File, filename string, opts UploadOptions) ([]*dataset, error) {
+	datasets, err := parseFile(file, filename, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ColumnTypes != "" {
+		if err := overrideColumnTypes(datasets, opts.ColumnTypes); err != nil {
+			return nil, err
+		}
+	}
+
+	return datasets, nil
+}
+
+func parseFile(file multipart.File, filename string, opts UploadOptions) ([]*dataset, error) {
+	var ds *dataset
+	var err error
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".zip":
+		var size int64
+		size, err = file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		ds, err = parseShapefileZip(file, size)
+	case ".gpkg":
+		return parseGeoPackage(file, opts.Layer)
+	case ".kml":
+		ds, err = parseKML(file)
+		if ds != nil {
+			ds.SRID = defaultSRID
+		}
+	case ".kmz":
+		var size int64
+		size, err = file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		ds, err = parseKMZ(file, size)
+		if ds != nil {
+			ds.SRID = defaultSRID
+		}
+	case ".gpx":
+		return parseGPX(file, opts.Layer)
+	case ".csv", ".txt":
+		ds, err = parseCSV(file, opts, ',')
+	case ".tsv":
+		ds, err = parseCSV(file, opts, '\t')
+	default:
+		ds, err = parseGeoJSON(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []*dataset{ds}, nil
+}
+
+// selectDatasets picks the layers named by the upload's layer option: one
+// layer by name, "*" for all, or the only layer when none is named.
+func selectDatasets(datasets []*dataset, layer string) ([]*dataset, error) {
+	var selected []*dataset
+	for _, ds := range datasets {
+		if layer == "*" || ds.Name == layer || (layer == "" && len(datasets) == 1) {
+			selected = append(selected, ds)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no layer matching %q", layer)
+	}
+	return selected, nil
+}
+
+// overrideColumnTypes applies the column_types option, a JSON object mapping
+// property or column names to Postgres types, e.g. {"kode": "TEXT"}.
+func overrideColumnTypes(datasets []*dataset, option string) error {
+	var overrides map[string]string
+	if err := json.Unmarshal([]byte(option), &overrides); err != nil {
+		return fmt.Errorf("column_types: %w", err)
+	}
+
+	unmatched := make(map[string]bool, len(overrides))
+	for name, colType := range overrides {
+		if _, ok := utils.NormalizeColumnType(colType); !ok {
+			return fmt.Errorf("column_types: unsupported type %q", colType)
+		}
+		unmatched[name] = true
+	}
+
+	for _, ds := range datasets {
+		if ds.ColumnTypes == nil {
+			ds.ColumnTypes = make(map[string]string)
+		}
+		for propName := range ds.propertyTypes() {
+			for name, colType := range overrides {
+				if name == propName || identifier.Normalize(name) == identifier.Normalize(propName) {
+					ds.ColumnTypes[propName], _ = utils.NormalizeColumnType(colType)
+					delete(unmatched, name)
+				}
+			}
+		}
+	}
+
+	for name := range unmatched {
+		return fmt.Errorf("column_types: no column %q", name)
+	}
+	return nil
+}
+
+// propertyTypes returns the Postgres type of every property in the dataset,
+// using the declared column type where the format provides one.
+func (d *dataset) propertyTypes() map[string]string {
+	propertyTypes := make(map[string]string)
+	for name, colType := range d.ColumnTypes {
+		propertyTypes[name] = colType
+	}
+	for name, colType := range d.inferredTypes {
+		if _, ok := d.ColumnTypes[name]; !ok {
+			propertyTypes[name] = colType
+		}
+	}
+
+	for _, feature := range d.Features {
+		for key, value := range feature.Properties {
+			if _, ok := d.ColumnTypes[key]; ok {
+				continue
+			}
+			inferredType := utils.InferPostgresType(value)
+			if existingType, ok := propertyTypes[key]; ok {
+				propertyTypes[key] = utils.ReconcileTypes(existingType, inferredType)
+			} else {
+				propertyTypes[key] = inferredType
+			}
+		}
+	}
+
+	// Columns that only ever held nulls.
+	for name, colType := range propertyTypes {
+		if colType == "" {
+			propertyTypes[name] = "TEXT"
+		}
+	}
+
+	return propertyTypes
+}
@@ -0,0 +1,286 @@
+package spatialdata
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/ewkb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/utils"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
+)
+
+// maxPreviewProblems caps the problems listed per layer in a preview.
+const maxPreviewProblems = 100
+
+// previewBatchSize is the number of geometries sent to PostGIS at once for
+// the validity check of a preview.
+const previewBatchSize = 1000
+
+// validityCheck returns the reason each invalid geometry of a batch, given as
+// hex EWKB, would be repaired or rejected on import, by index in the batch.
+type validityCheck func(geometries []string) (map[int]string, error)
+
+// PreviewSpatialData parses an upload exactly as CreateSpatialData would and
+// reports what would be imported, without writing anything.
+func (s *SpatialDataService) PreviewSpatialData(opts UploadOptions, file multipart.File, filename string) (*PreviewReport, error) {
+	datasets, err := parseUpload(file, filename, opts)
+	if err != nil {
+		return nil, errors.ErrInvalidInput
+	}
+
+	targetSRID := opts.TargetSRID
+	if targetSRID == 0 {
+		targetSRID = defaultSRID
+	}
+	if err := s.checkSRID(targetSRID); err != nil {
+		return nil, err
+	}
+
+	// Topology is checked by PostGIS as the import does, in a read-only
+	// transaction that is rolled back.
+	tx, err := s.db.BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	defer tx.Rollback()
+	check := func(geometries []string) (map[int]string, error) {
+		return invalidGeometries(tx, geometries, targetSRID)
+	}
+
+	report := &PreviewReport{}
+	for _, ds := range datasets {
+		detected := ds.SRID
+		if err := s.resolveSourceSRID(ds, opts.SourceSRID); err != nil {
+			return nil, err
+		}
+
+		layer, err := previewDataset(ds, check)
+		if err == errors.ErrInternalServer {
+			return nil, err
+		}
+		if err != nil {
+			return nil, errors.ErrInvalidInput
+		}
+		layer.DetectedSRID = detected
+		report.Layers = append(report.Layers, *layer)
+	}
+
+	return report, nil
+}
+
+// previewDataset reports on the features of ds. Geometries with a valid
+// structure are passed to check in batches, and the ones it finds invalid
+// are reported with its reason.
+func previewDataset(ds *dataset, check validityCheck) (*LayerPreview, error) {
+	propertyTypes := ds.propertyTypes()
+	propertyNames := make([]string, 0, len(propertyTypes))
+	for propName := range propertyTypes {
+		propertyNames = append(propertyNames, propName)
+	}
+	sort.Strings(propertyNames)
+	columns := identifier.Columns(propertyNames)
+
+	layer := &LayerPreview{
+		Name:          ds.Name,
+		SRID:          ds.SRID,
+		GeometryTypes: make(map[string]int),
+		Columns:       []ColumnPreview{},
+		Problems:      []Problem{},
+	}
+	nullCounts := make(map[string]int, len(propertyNames))
+	var bound orb.Bound
+	hasBound := false
+
+	addProblem := func(problem Problem) {
+		layer.ProblemCount++
+		if len(layer.Problems) < maxPreviewProblems {
+			layer.Problems = append(layer.Problems, problem)
+		}
+	}
+
+	var batch []string
+	var batchPositions []int
+	checkBatch := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		reasons, err := check(batch)
+		if err != nil {
+			return errors.ErrInternalServer
+		}
+		for i, position := range batchPositions {
+			if reason, ok := reasons[i]; ok {
+				addProblem(Problem{Feature: position, Message: reason})
+			}
+		}
+		batch, batchPositions = batch[:0], batchPositions[:0]
+		return nil
+	}
+
+	err := ds.forEach(func(position int, feature *geojson.Feature) error {
+		layer.FeatureCount++
+		layer.GeometryTypes[strings.ToUpper(feature.Geometry.GeoJSONType())]++
+
+		if problem := geometryProblem(feature.Geometry); problem != "" {
+			addProblem(Problem{Feature: position, Message: problem})
+		} else {
+			geomHex, err := ewkb.MarshalToHex(feature.Geometry, ds.SRID)
+			if err != nil {
+				return err
+			}
+			batch = append(batch, geomHex)
+			batchPositions = append(batchPositions, position)
+			if hasBound {
+				bound = bound.Union(feature.Geometry.Bound())
+			} else {
+				bound, hasBound = feature.Geometry.Bound(), true
+			}
+		}
+
+		for _, propName := range propertyNames {
+			value, ok := feature.Properties[propName]
+			if !ok || value == nil {
+				nullCounts[propName]++
+				continue
+			}
+			if _, err := utils.ConvertToType(value, propertyTypes[propName]); err != nil {
+				addProblem(Problem{Feature: position, Column: columns[propName], Message: err.Error()})
+			}
+		}
+
+		if len(batch) >= previewBatchSize {
+			return checkBatch()
+		}
+		return nil
+	})
+	if err == nil {
+		err = checkBatch()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Invalid geometries are found a batch at a time, after the other
+	// problems of their batch.
+	sort.SliceStable(layer.Problems, func(i, j int) bool {
+		return layer.Problems[i].Feature < layer.Problems[j].Feature
+	})
+
+	found := make([]string, 0, len(layer.GeometryTypes))
+	for geomType := range layer.GeometryTypes {
+		found = append(found, geomType)
+	}
+	layer.GeometryType = detectGeometryType(found)
+
+	if hasBound {
+		layer.BBox = []float64{bound.Min[0], bound.Min[1], bound.Max[0], bound.Max[1]}
+	}
+	for _, propName := range propertyNames {
+		layer.Columns = append(layer.Columns, ColumnPreview{
+			Property:  propName,
+			Name:      columns[propName],
+			Type:      propertyTypes[propName],
+			NullCount: nullCounts[propName],
+		})
+	}
+
+	return layer, nil
+}
+
+// geometryProblem returns why geom cannot be imported as is, or "" if its
+// structure is valid. Topology, such as self-intersections, is left to
+// PostGIS.
+func geometryProblem(geom orb.Geometry) string {
+	switch g := geom.(type) {
+	case orb.Point:
+		return pointProblem(g)
+	case orb.MultiPoint:
+		if len(g) == 0 {
+			return "empty geometry"
+		}
+		for _, p := range g {
+			if problem := pointProblem(p); problem != "" {
+				return problem
+			}
+		}
+	case orb.LineString:
+		if len(g) < 2 {
+			return "line string has fewer than 2 points"
+		}
+		return pointsProblem(g)
+	case orb.MultiLineString:
+		if len(g) == 0 {
+			return "empty geometry"
+		}
+		for _, line := range g {
+			if problem := geometryProblem(line); problem != "" {
+				return problem
+			}
+		}
+	case orb.Ring:
+		if len(g) < 4 {
+			return "ring has fewer than 4 points"
+		}
+		if !g.Closed() {
+			return "ring is not closed"
+		}
+		return pointsProblem(g)
+	case orb.Polygon:
+		if len(g) == 0 {
+			return "empty geometry"
+		}
+		for _, ring := range g {
+			if problem := geometryProblem(ring); problem != "" {
+				return problem
+			}
+		}
+	case orb.MultiPolygon:
+		if len(g) == 0 {
+			return "empty geometry"
+		}
+		for _, polygon := range g {
+			if problem := geometryProblem(polygon); problem != "" {
+				return problem
+			}
+		}
+	case orb.Collection:
+		if len(g) == 0 {
+			return "empty geometry"
+		}
+		for _, member := range g {
+			if problem := geometryProblem(member); problem != "" {
+				return problem
+			}
+		}
+	case orb.Bound:
+		return geometryProblem(g.ToPolygon())
+	default:
+		return fmt.Sprintf("unsupported geometry %T", geom)
+	}
+	return ""
+}
+
+func pointsProblem(points []orb.Point) string {
+	for _, p := range points {
+		if problem := pointProblem(p); problem != "" {
+			return problem
+		}
+	}
+	return ""
+}
+
+func pointProblem(p orb.Point) string {
+	for _, v := range p {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "coordinate is not a finite number"
+		}
+	}
+	return ""
+}
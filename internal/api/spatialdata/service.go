@@ -1,280 +1,983 @@
 package spatialdata
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
+	"mime/multipart"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/ewkb"
 	"github.com/paulmach/orb/encoding/wkb"
 	"github.com/paulmach/orb/geojson"
+	"github.com/samdyra/go-geo/internal/api/job"
 	"github.com/samdyra/go-geo/internal/utils"
 	"github.com/samdyra/go-geo/internal/utils/errors"
+	"github.com/samdyra/go-geo/internal/utils/identifier"
 )
 
+// defaultBatchSize is the number of rows sent in one COPY during an import
+// when no batch size is configured.
+const defaultBatchSize = 5000
+
 type SpatialDataService struct {
-    db *sqlx.DB
+	db        *sqlx.DB
+	jobs      *job.JobService
+	batchSize int
+	// storeGeom3857 adds a Web Mercator geom_3857 column to imported tables.
+	storeGeom3857 bool
+	// tiles is told when the data of a table changes; it may be nil.
+	tiles TileInvalidator
+}
+
+// TileInvalidator drops the cached vector tiles of a table.
+type TileInvalidator interface {
+	InvalidateTable(tableName string)
+}
+
+func NewSpatialDataService(db *sqlx.DB, jobs *job.JobService, batchSize int, storeGeom3857 bool, tiles TileInvalidator) *SpatialDataService {
+	if batchSize < 1 {
+		batchSize = defaultBatchSize
+	}
+	return &SpatialDataService{db: db, jobs: jobs, batchSize: batchSize, storeGeom3857: storeGeom3857, tiles: tiles}
+}
+
+// invalidateTiles drops the cached tiles of tableName once a change to it is
+// committed.
+func (s *SpatialDataService) invalidateTiles(tableName string) {
+	if s.tiles != nil {
+		s.tiles.InvalidateTable(tableName)
+	}
+}
+
+// CreateSpatialData imports the upload and returns the names of the tables
+// created, which are normalised from the requested table name, with the
+// geometries that were repaired or left out.
+func (s *SpatialDataService) CreateSpatialData(spatial_data SpatialDataCreate, file multipart.File, filename string, username string) (*ImportResult, error) {
+	tableName, err := identifier.Table(spatial_data.TableName)
+	if err != nil {
+		return nil, err
+	}
+	spatial_data.TableName = tableName
+
+	spatial_data.Type, err = normalizeGeometryType(spatial_data.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	datasets, err := parseUpload(file, filename, spatial_data.UploadOptions)
+	if err != nil {
+		return nil, errors.ErrInvalidInput
+	}
+
+	return s.importDatasets(spatial_data, datasets, username, nil)
 }
 
-func NewSpatialDataService(db *sqlx.DB) *SpatialDataService {
-    return &SpatialDataService{db: db}
+// EnqueueSpatialData queues the upload as an import job and returns the job
+// without waiting for it to run.
+func (s *SpatialDataService) EnqueueSpatialData(spatial_data SpatialDataCreate, file multipart.File, filename string, username string) (*job.Job, error) {
+	tableName, err := identifier.Table(spatial_data.TableName)
+	if err != nil {
+		return nil, err
+	}
+	spatial_data.TableName = tableName
+
+	spatial_data.Type, err = normalizeGeometryType(spatial_data.Type)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkInvalidGeometryMode(spatial_data.InvalidGeometry); err != nil {
+		return nil, err
+	}
+	if err := s.checkTableAvailable(spatial_data.TableName); err != nil {
+		return nil, err
+	}
+
+	options, err := json.Marshal(spatial_data.UploadOptions)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	j := &job.Job{
+		TableName: spatial_data.TableName,
+		Type:      spatial_data.Type,
+		Filename:  filename,
+		Options:   options,
+		CreatedBy: username,
+	}
+	if err := s.jobs.CreateJob(j, file); err != nil {
+		return nil, err
+	}
+
+	return j, nil
 }
-func (s *SpatialDataService) CreateSpatialData(spatial_data SpatialDataCreate, file io.Reader, username string) error {
-    var existsInSchema, existsInSpatialData bool
-
-    // Check in information_schema.tables
-    err := s.db.QueryRow("SELECT EXISTS (SELECT FROM information_schema.tables WHERE table_name = $1)", spatial_data.TableName).Scan(&existsInSchema)
-    if err != nil {
-        return fmt.Errorf("error checking schema: %w", errors.ErrInternalServer)
-    }
-
-    // Check in spatial_data table
-    err = s.db.QueryRow("SELECT EXISTS (SELECT FROM spatial_data WHERE table_name = $1)", spatial_data.TableName).Scan(&existsInSpatialData)
-    if err != nil {
-        return fmt.Errorf("error checking spatial_data: %w", errors.ErrInternalServer)
-    }
-
-    if existsInSchema {
-        return errors.ErrResourceAlreadyExists
-    }
-
-    if existsInSpatialData {
-        return errors.ErrResourceAlreadyExists
-    }
-    
-    tx, err := s.db.Beginx()
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-    defer tx.Rollback()
-
-    now := time.Now()
-
-    _, err = tx.Exec(`
-        INSERT INTO spatial_data (table_name, type, created_at, updated_at, created_by, updated_by)
-        VALUES ($1, $2, $3, $4, $5, $6)
-    `, spatial_data.TableName, spatial_data.Type, now, now, username, username)
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-
-    fileBytes, err := io.ReadAll(file)
-    if err != nil {
-        return errors.ErrInvalidInput
-    }
-
-    fc, err := geojson.UnmarshalFeatureCollection(fileBytes)
-    if err != nil {
-        return errors.ErrInvalidInput
-    }
-
-    propertyTypes := make(map[string]string)
-    for _, feature := range fc.Features {
-        for key, value := range feature.Properties {
-            inferredType := utils.InferPostgresType(value)
-            if existingType, ok := propertyTypes[key]; ok {
-                propertyTypes[key] = utils.ReconcileTypes(existingType, inferredType)
-            } else {
-                propertyTypes[key] = inferredType
-            }
-        }
-    }
-
-    createTableSQL := fmt.Sprintf(`
+
+// RunImportJob is the job.Runner for queued uploads. Repaired and skipped
+// geometries are reported as warnings.
+func (s *SpatialDataService) RunImportJob(j *job.Job, progress job.Progress) ([]string, []string, error) {
+	spatial_data := SpatialDataCreate{TableName: j.TableName, Type: j.Type}
+	if err := json.Unmarshal(j.Options, &spatial_data.UploadOptions); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(j.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	datasets, err := parseUpload(file, j.Filename, spatial_data.UploadOptions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid file: %w", err)
+	}
+
+	result, err := s.importDatasets(spatial_data, datasets, j.CreatedBy, progress)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	warnings := make([]string, len(result.GeometryIssues))
+	for i, issue := range result.GeometryIssues {
+		warnings[i] = issue.String()
+	}
+	return result.TableNames, warnings, nil
+}
+
+// importDatasets imports parsed datasets in one transaction and returns the
+// names of the tables created. progress, if not nil, is called as features
+// are inserted.
+func (s *SpatialDataService) importDatasets(spatial_data SpatialDataCreate, datasets []*dataset, username string, progress job.Progress) (*ImportResult, error) {
+	geometryMode, err := checkInvalidGeometryMode(spatial_data.InvalidGeometry)
+	if err != nil {
+		return nil, err
+	}
+
+	targetSRID := spatial_data.TargetSRID
+	if targetSRID == 0 {
+		targetSRID = defaultSRID
+	}
+	if err := s.checkSRID(targetSRID); err != nil {
+		return nil, err
+	}
+
+	requestedType, err := normalizeGeometryType(spatial_data.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	// A multi-layer upload creates one table per layer, named after the
+	// layer, and a split layer one table per geometry family.
+	var parts []*dataset
+	var tableNames []string
+	for _, ds := range datasets {
+		if err := s.resolveSourceSRID(ds, spatial_data.SourceSRID); err != nil {
+			return nil, err
+		}
+
+		tableName := spatial_data.TableName
+		if len(datasets) > 1 {
+			tableName = layerTableName(tableName, ds.Name)
+		}
+
+		if !spatial_data.SplitGeometryTypes {
+			parts = append(parts, ds)
+			tableNames = append(tableNames, tableName)
+			continue
+		}
+		split := ds.splitByGeometryFamily()
+		for _, part := range split {
+			parts = append(parts, part)
+			if len(split) > 1 {
+				tableNames = append(tableNames, layerTableName(tableName, strings.ToLower(part.GeometryType)))
+			} else {
+				tableNames = append(tableNames, tableName)
+			}
+		}
+	}
+
+	// The requested type only applies when the upload makes a single table.
+	if len(parts) > 1 {
+		requestedType = ""
+	}
+
+	for _, tableName := range tableNames {
+		if err := s.checkTableAvailable(tableName); err != nil {
+			return nil, err
+		}
+	}
+
+	total, processed := 0, 0
+	for _, ds := range parts {
+		total += ds.featureCount()
+	}
+	onInserted := func(n int) {
+		processed += n
+		if progress != nil {
+			progress(processed, total)
+		}
+	}
+	if progress != nil {
+		progress(0, total)
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{TableNames: tableNames, GeometryIssues: []GeometryIssue{}}
+	for i, ds := range parts {
+		issues, err := s.importDataset(tx, tableNames[i], requestedType, ds, targetSRID, geometryMode, username, onInserted)
+		if err != nil {
+			return nil, err
+		}
+		result.GeometryIssues = append(result.GeometryIssues, issues...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	return result, nil
+}
+
+// checkTableAvailable returns ErrResourceAlreadyExists if tableName is taken
+// either in the database or in the spatial_data catalog.
+func (s *SpatialDataService) checkTableAvailable(tableName string) error {
+	var existsInSchema, existsInSpatialData bool
+
+	// Check in information_schema.tables
+	err := s.db.QueryRow("SELECT EXISTS (SELECT FROM information_schema.tables WHERE table_name = $1)", tableName).Scan(&existsInSchema)
+	if err != nil {
+		return fmt.Errorf("error checking schema: %w", errors.ErrInternalServer)
+	}
+
+	// Check in spatial_data table
+	err = s.db.QueryRow("SELECT EXISTS (SELECT FROM spatial_data WHERE table_name = $1)", tableName).Scan(&existsInSpatialData)
+	if err != nil {
+		return fmt.Errorf("error checking spatial_data: %w", errors.ErrInternalServer)
+	}
+
+	if existsInSchema {
+		return errors.ErrResourceAlreadyExists
+	}
+
+	if existsInSpatialData {
+		return errors.ErrResourceAlreadyExists
+	}
+
+	return nil
+}
+
+// resolveSourceSRID settles the SRID of the dataset's coordinates: the
+// upload's source_srid wins over the SRID detected in the file, and files that
+// declare nothing are assumed to be WGS 84.
+func (s *SpatialDataService) resolveSourceSRID(ds *dataset, sourceSRID int) error {
+	if sourceSRID != 0 {
+		ds.SRID = sourceSRID
+	} else if ds.SRID == 0 {
+		ds.SRID = defaultSRID
+	}
+	return s.checkSRID(ds.SRID)
+}
+
+// checkSRID returns ErrInvalidInput if srid is not in PostGIS's spatial_ref_sys.
+func (s *SpatialDataService) checkSRID(srid int) error {
+	var exists bool
+	err := s.db.Get(&exists, "SELECT EXISTS (SELECT FROM spatial_ref_sys WHERE srid = $1)", srid)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if !exists {
+		return errors.ErrInvalidInput
+	}
+	return nil
+}
+
+// importDataset creates tableName from the dataset's columns, loads its
+// features, reprojected from ds.SRID to targetSRID and validated according to
+// geometryMode, types the geometry column and registers the table in the
+// spatial_data catalog. requestedType, if not empty, is the geometry type the
+// features must have. onInserted is called with the number of features
+// written after each batch.
+func (s *SpatialDataService) importDataset(tx *sqlx.Tx, tableName, requestedType string, ds *dataset, targetSRID int, geometryMode, username string, onInserted func(n int)) ([]GeometryIssue, error) {
+	propertyTypes := ds.propertyTypes()
+
+	propertyNames := make([]string, 0, len(propertyTypes))
+	for propName := range propertyTypes {
+		propertyNames = append(propertyNames, propName)
+	}
+	sort.Strings(propertyNames)
+	columns := identifier.Columns(propertyNames)
+
+	// The table is loaded in the source SRID and reprojected in one pass
+	// afterwards, since COPY cannot transform geometries.
+	createTableSQL := fmt.Sprintf(`
     CREATE TABLE IF NOT EXISTS %s (
         id SERIAL PRIMARY KEY,
-        geom GEOMETRY,
+        geom GEOMETRY(GEOMETRY, %d),
         created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
         updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
         created_by VARCHAR(255),
-        updated_by VARCHAR(255)`, spatial_data.TableName)
-
-    for propName, propType := range propertyTypes {
-        createTableSQL += fmt.Sprintf(",\n        %s %s", propName, propType)
-    }
-    createTableSQL += "\n    )"
-
-    _, err = tx.Exec(createTableSQL)
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-
-    insertSQL := fmt.Sprintf("INSERT INTO %s (geom, created_by, updated_by", spatial_data.TableName)
-    valueSQL := ") VALUES (ST_GeomFromWKB($1, 4326), $2, $3"
-    paramCount := 4
-
-    propertyNames := make([]string, 0, len(propertyTypes))
-    for propName := range propertyTypes {
-        propertyNames = append(propertyNames, propName)
-        insertSQL += fmt.Sprintf(", %s", propName)
-        valueSQL += fmt.Sprintf(", $%d", paramCount)
-        paramCount++
-    }
-    insertSQL += valueSQL + ")"
-
-    for _, feature := range fc.Features {
-        geom := feature.Geometry
-        wkbData, err := wkb.Marshal(geom)
-        if err != nil {
-            return errors.ErrInternalServer
-        }
-
-        params := []interface{}{wkbData, username, username}
-        for _, propName := range propertyNames {
-            if val, ok := feature.Properties[propName]; ok {
-                convertedVal, err := utils.ConvertToType(val, propertyTypes[propName])
-                if err != nil {
-                    return errors.ErrInvalidInput
-                }
-                params = append(params, convertedVal)
-            } else {
-                params = append(params, nil)
-            }
-        }
-
-        _, err = tx.Exec(insertSQL, params...)
-        if err != nil {
-            return errors.ErrInternalServer
-        }
-    }
-
-    return tx.Commit()
+        updated_by VARCHAR(255)`, identifier.Quote(tableName), ds.SRID)
+
+	for _, propName := range propertyNames {
+		createTableSQL += fmt.Sprintf(",\n        %s %s", identifier.Quote(columns[propName]), propertyTypes[propName])
+	}
+	createTableSQL += "\n    )"
+
+	_, err := tx.Exec(createTableSQL)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	positions, err := s.copyFeatures(tx, tableName, ds, propertyNames, columns, propertyTypes, username, onInserted)
+	if err != nil {
+		return nil, err
+	}
+
+	if ds.SRID != targetSRID {
+		_, err = tx.Exec(fmt.Sprintf(
+			"ALTER TABLE %s ALTER COLUMN geom TYPE GEOMETRY(GEOMETRY, %d) USING ST_Transform(geom, %d)",
+			identifier.Quote(tableName), targetSRID, targetSRID))
+		if err != nil {
+			return nil, errors.ErrInternalServer
+		}
+	}
+
+	// Validity is checked after reprojection, as that is what is stored,
+	// and the type after repair, which can turn a polygon into a multipolygon.
+	issues, err := validateGeometries(tx, identifier.Quote(tableName), tableName, geometryMode, positions)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := distinctGeometryTypes(tx, identifier.Quote(tableName))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	geomType, err := resolveGeometryType(tableName, requestedType, ds.GeometryType, found)
+	if err != nil {
+		return nil, err
+	}
+	if geomType != "GEOMETRY" {
+		if err := enforceGeometryType(tx, identifier.Quote(tableName), geomType, targetSRID); err != nil {
+			return nil, errors.ErrInternalServer
+		}
+	}
+
+	// A table stored in Web Mercator needs no second copy.
+	withGeom3857 := s.storeGeom3857 && targetSRID != 3857
+	if err := indexTable(tx, tableName, geomType, withGeom3857); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+        INSERT INTO spatial_data (table_name, type, srid, source_srid, has_geom_3857, created_at, updated_at, created_by, updated_by)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+    `, tableName, geomType, targetSRID, ds.SRID, withGeom3857, now, now, username, username)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if err := refreshMetadata(tx, tableName); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	return issues, nil
 }
 
+// copyFeatures loads the dataset's features into tableName with COPY and
+// returns the source position of each feature copied, in order. The COPY is
+// flushed every s.batchSize rows so that neither a streamed dataset nor the
+// driver buffers the whole file.
+func (s *SpatialDataService) copyFeatures(tx *sqlx.Tx, tableName string, ds *dataset, propertyNames []string, columns, propertyTypes map[string]string, username string, onInserted func(n int)) ([]int, error) {
+	copyColumns := []string{"geom", "created_by", "updated_by"}
+	for _, propName := range propertyNames {
+		copyColumns = append(copyColumns, columns[propName])
+	}
+
+	var stmt *sql.Stmt
+	var positions []int
+	pending := 0
+	flush := func() error {
+		if stmt == nil {
+			return nil
+		}
+		_, err := stmt.Exec()
+		if closeErr := stmt.Close(); err == nil {
+			err = closeErr
+		}
+		stmt = nil
+		if err != nil {
+			return errors.ErrInternalServer
+		}
+		onInserted(pending)
+		pending = 0
+		return nil
+	}
+
+	err := ds.forEach(func(position int, feature *geojson.Feature) error {
+		geomHex, err := ewkb.MarshalToHex(feature.Geometry, ds.SRID)
+		if err != nil {
+			return errors.ErrInternalServer
+		}
+
+		params := []interface{}{geomHex, username, username}
+		for _, propName := range propertyNames {
+			if val, ok := feature.Properties[propName]; ok {
+				convertedVal, err := utils.ConvertToType(val, propertyTypes[propName])
+				if err != nil {
+					return errors.ErrInvalidInput
+				}
+				params = append(params, convertedVal)
+			} else {
+				params = append(params, nil)
+			}
+		}
+
+		if stmt == nil {
+			stmt, err = tx.Prepare(pq.CopyIn(tableName, copyColumns...))
+			if err != nil {
+				return errors.ErrInternalServer
+			}
+		}
+		if _, err := stmt.Exec(params...); err != nil {
+			return errors.ErrInternalServer
+		}
+		positions = append(positions, position)
+
+		pending++
+		if pending >= s.batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if stmt != nil {
+			stmt.Close()
+		}
+		switch err {
+		case errors.ErrInvalidInput, errors.ErrInternalServer:
+			return nil, err
+		default:
+			// Anything else comes from reading the file again.
+			return nil, errors.ErrInvalidInput
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
 
+// spatialDataColumns are the catalog columns scanned into SpatialData.
+const spatialDataColumns = `id, table_name, type, srid, source_srid, has_geom_3857,
+    feature_count, bbox, columns, size_bytes, created_at, updated_at, created_by, updated_by`
 
 func (s *SpatialDataService) GetSpatialDataList() ([]SpatialData, error) {
-    query := `SELECT id, table_name, type, created_at, updated_at, created_by, updated_by FROM spatial_data`
-    
-    var spatialDataList []SpatialData
-    err := s.db.Select(&spatialDataList, query)
-    if err != nil {
-        return nil, errors.ErrInternalServer
-    }
-
-    return spatialDataList, nil
+	query := `SELECT ` + spatialDataColumns + ` FROM spatial_data`
+
+	var spatialDataList []SpatialData
+	err := s.db.Select(&spatialDataList, query)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	return spatialDataList, nil
+}
+
+// GetSpatialData returns the catalog entry of tableName, with its metadata.
+func (s *SpatialDataService) GetSpatialData(tableName string) (*SpatialData, error) {
+	var spatialData SpatialData
+	err := s.db.Get(&spatialData, `SELECT `+spatialDataColumns+` FROM spatial_data WHERE table_name = $1`, tableName)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	return &spatialData, nil
+}
+
+// ExportGeoPackage writes tableName to a temporary GeoPackage file and returns
+// its path. The caller is responsible for removing the file.
+func (s *SpatialDataService) ExportGeoPackage(tableName string) (string, error) {
+	var exists bool
+	err := s.db.Get(&exists, "SELECT EXISTS (SELECT FROM spatial_data WHERE table_name = $1)", tableName)
+	if err != nil {
+		return "", errors.ErrInternalServer
+	}
+	if !exists {
+		return "", errors.ErrNotFound
+	}
+
+	columns, err := tableColumns(s.db, tableName)
+	if err != nil {
+		return "", errors.ErrInternalServer
+	}
+
+	names := make([]string, len(columns))
+	types := make([]string, len(columns))
+	// GeoPackages are always written in WGS 84, whatever the table's SRID.
+	selectCols := []string{"ST_AsBinary(ST_Transform(geom, 4326))"}
+	for i, col := range columns {
+		names[i] = col.Name
+		types[i] = sqliteType(col.DataType)
+		selectCols = append(selectCols, identifier.Quote(col.Name))
+	}
+
+	tmp, err := os.CreateTemp("", "export-*.gpkg")
+	if err != nil {
+		return "", errors.ErrInternalServer
+	}
+	tmp.Close()
+
+	if err := s.writeGeoPackage(tmp.Name(), tableName, names, types, selectCols); err != nil {
+		os.Remove(tmp.Name())
+		return "", errors.ErrInternalServer
+	}
+
+	return tmp.Name(), nil
+}
+
+func (s *SpatialDataService) writeGeoPackage(path, tableName string, names, types, selectCols []string) error {
+	w, err := newGeoPackageWriter(path, tableName, "GEOMETRY", names, types)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf("SELECT %s FROM %s ORDER BY id", strings.Join(selectCols, ", "), identifier.Quote(tableName)))
+	if err != nil {
+		w.Close()
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, len(selectCols))
+	pointers := make([]interface{}, len(selectCols))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			w.Close()
+			return err
+		}
+
+		var geom orb.Geometry
+		if data, ok := values[0].([]byte); ok {
+			geom, err = wkb.Unmarshal(data)
+			if err != nil {
+				w.Close()
+				return err
+			}
+		}
+
+		attrs := make([]interface{}, len(names))
+		for i := range names {
+			attrs[i] = sqliteValue(values[i+1])
+		}
+		if err := w.Write(geom, attrs); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
 }
 
 func (s *SpatialDataService) DeleteSpatialData(tableName string) error {
-    tx, err := s.db.Beginx()
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-    defer tx.Rollback()
-
-    // Delete from layer_layer_group
-    _, err = tx.Exec("DELETE FROM layer_layer_group WHERE layer_id IN (SELECT id FROM layer WHERE spatial_data_id = (SELECT id FROM spatial_data WHERE table_name = $1))", tableName)
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-
-    // Delete associated layers
-    _, err = tx.Exec("DELETE FROM layer WHERE spatial_data_id = (SELECT id FROM spatial_data WHERE table_name = $1)", tableName)
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-
-    // Delete from spatial_data table
-    result, err := tx.Exec("DELETE FROM spatial_data WHERE table_name = $1", tableName)
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-
-    if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
-        return errors.ErrNotFound
-    }
-
-    // Drop the spatial spatial_data table
-    _, err = tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", tableName))
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-
-    return tx.Commit()
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	defer tx.Rollback()
+
+	// Touch the groups losing the table's layers, whose tiles are versioned
+	// by their updated_at.
+	_, err = tx.Exec(`UPDATE layer_group SET updated_at = CURRENT_TIMESTAMP
+        WHERE id IN (SELECT llg.layer_group_id FROM layer_layer_group llg
+            JOIN layer l ON l.id = llg.layer_id
+            JOIN spatial_data sd ON sd.id = l.spatial_data_id
+            WHERE sd.table_name = $1)`, tableName)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+
+	// Delete from layer_layer_group
+	_, err = tx.Exec("DELETE FROM layer_layer_group WHERE layer_id IN (SELECT id FROM layer WHERE spatial_data_id = (SELECT id FROM spatial_data WHERE table_name = $1))", tableName)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+
+	// Delete associated layers
+	_, err = tx.Exec("DELETE FROM layer WHERE spatial_data_id = (SELECT id FROM spatial_data WHERE table_name = $1)", tableName)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+
+	// Delete from spatial_data table
+	result, err := tx.Exec("DELETE FROM spatial_data WHERE table_name = $1", tableName)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.ErrNotFound
+	}
+
+	// Drop the spatial spatial_data table
+	_, err = tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", identifier.Quote(tableName)))
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.invalidateTiles(tableName)
+	return nil
 }
 
-func (s *SpatialDataService) EditSpatialData(oldTableName string, spatial_data SpatialDataEdit, file io.Reader, username string) error {
-    tx, err := s.db.Beginx()
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-    defer tx.Rollback()
-
-    // Update spatial_data table
-    query := "UPDATE spatial_data SET updated_at = $1, updated_by = $2"
-    params := []interface{}{time.Now(), username}
-    paramCount := 3
-
-    if spatial_data.TableName != nil {
-        query += fmt.Sprintf(", table_name = $%d", paramCount)
-        params = append(params, *spatial_data.TableName)
-        paramCount++
-    }
-
-    query += " WHERE table_name = $" + fmt.Sprintf("%d", paramCount)
-    params = append(params, oldTableName)
-
-    result, err := tx.Exec(query, params...)
-    if err != nil {
-        return errors.ErrInternalServer
-    }
-
-    if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
-        return errors.ErrNotFound
-    }
-
-    // If table name was changed
-    if spatial_data.TableName != nil && *spatial_data.TableName != oldTableName {
-        // Rename the spatial spatial_data table
-        _, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", oldTableName, *spatial_data.TableName))
-        if err != nil {
-            return errors.ErrInternalServer
-        }
-        oldTableName = *spatial_data.TableName
-    }
-
-    // If new file is provided
-    if file != nil {
-        // Clear existing spatial_data from the table
-        _, err = tx.Exec(fmt.Sprintf("TRUNCATE TABLE %s", oldTableName))
-        if err != nil {
-            return errors.ErrInternalServer
-        }
-
-        // Read and parse the new GeoJSON file
-        fileBytes, err := io.ReadAll(file)
-        if err != nil {
-            return errors.ErrInvalidInput
-        }
-
-        fc, err := geojson.UnmarshalFeatureCollection(fileBytes)
-        if err != nil {
-            return errors.ErrInvalidInput
-        }
-
-        // Insert new features into the table
-        for _, feature := range fc.Features {
-            geom := feature.Geometry
-            properties, err := json.Marshal(feature.Properties)
-            if err != nil {
-                return errors.ErrInternalServer
-            }
-
-            wkbData, err := wkb.Marshal(geom)
-            if err != nil {
-                return errors.ErrInternalServer
-            }
-
-            _, err = tx.Exec(fmt.Sprintf(`
-                INSERT INTO %s (geom, properties, created_by, updated_by)
-                VALUES (ST_GeomFromWKB($1, 4326), $2, $3, $4)
-            `, oldTableName), wkbData, properties, username, username)
-            if err != nil {
-                return errors.ErrInternalServer
-            }
-        }
-    }
-
-    return tx.Commit()
-}
\ No newline at end of file
+// EditSpatialData renames a spatial data table and/or loads a new file into
+// it. The file replaces the table's features, is appended to them or is
+// upserted on a key column, depending on spatial_data.Mode. Columns found in
+// the file but not in the table are added.
+func (s *SpatialDataService) EditSpatialData(oldTableName string, spatial_data SpatialDataEdit, file multipart.File, filename string, username string) (*EditResult, error) {
+	mode := spatial_data.Mode
+	if mode == "" {
+		mode = ModeReplace
+	}
+	geometryMode, err := checkInvalidGeometryMode(spatial_data.InvalidGeometry)
+	if err != nil {
+		return nil, err
+	}
+	switch mode {
+	case ModeReplace, ModeAppend:
+	case ModeUpsert:
+		if spatial_data.KeyColumn == "" {
+			return nil, errors.ErrInvalidInput
+		}
+	default:
+		return nil, errors.ErrInvalidInput
+	}
+
+	if spatial_data.TableName != nil {
+		newTableName, err := identifier.Table(*spatial_data.TableName)
+		if err != nil {
+			return nil, err
+		}
+		spatial_data.TableName = &newTableName
+
+		if newTableName != oldTableName {
+			if err := s.checkTableAvailable(newTableName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var ds *dataset
+	if file != nil {
+		datasets, err := parseUpload(file, filename, spatial_data.UploadOptions)
+		if err != nil || len(datasets) != 1 {
+			return nil, errors.ErrInvalidInput
+		}
+		ds = datasets[0]
+		if err := s.resolveSourceSRID(ds, spatial_data.SourceSRID); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	defer tx.Rollback()
+
+	// Update spatial_data table
+	query := "UPDATE spatial_data SET updated_at = $1, updated_by = $2"
+	params := []interface{}{time.Now(), username}
+	paramCount := 3
+
+	if spatial_data.TableName != nil {
+		query += fmt.Sprintf(", table_name = $%d", paramCount)
+		params = append(params, *spatial_data.TableName)
+		paramCount++
+	}
+
+	query += " WHERE table_name = $" + fmt.Sprintf("%d", paramCount) + " RETURNING srid"
+	params = append(params, oldTableName)
+
+	var srid int
+	err = tx.Get(&srid, query, params...)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	// Tiles cached under the name the table had before the edit are dropped
+	// too.
+	originalTableName := oldTableName
+
+	// If table name was changed
+	if spatial_data.TableName != nil && *spatial_data.TableName != oldTableName {
+		// Rename the spatial spatial_data table
+		_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", identifier.Quote(oldTableName), identifier.Quote(*spatial_data.TableName)))
+		if err != nil {
+			return nil, errors.ErrInternalServer
+		}
+		oldTableName = *spatial_data.TableName
+	}
+
+	result := &EditResult{GeometryIssues: []GeometryIssue{}}
+	if ds != nil {
+		result, err = s.loadDataset(tx, oldTableName, srid, ds, mode, spatial_data.KeyColumn, geometryMode, username)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := refreshMetadata(tx, oldTableName); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	s.invalidateTiles(oldTableName)
+	if originalTableName != oldTableName {
+		s.invalidateTiles(originalTableName)
+	}
+
+	return result, nil
+}
+
+// loadDataset writes the dataset into an existing table. The features are
+// first copied into a temporary staging table with the same columns, where
+// they are reprojected and validated, and which the replace, append and
+// upsert statements then read from.
+func (s *SpatialDataService) loadDataset(tx *sqlx.Tx, tableName string, srid int, ds *dataset, mode, keyColumn, geometryMode, username string) (*EditResult, error) {
+	existing, err := tableColumns(tx, tableName)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	existingTypes := make(map[string]string, len(existing))
+	for _, col := range existing {
+		existingTypes[col.Name] = postgresColumnType(col.DataType)
+	}
+
+	propertyTypes := ds.propertyTypes()
+	propertyNames := make([]string, 0, len(propertyTypes))
+	for propName := range propertyTypes {
+		propertyNames = append(propertyNames, propName)
+	}
+	sort.Strings(propertyNames)
+	columns := identifier.Columns(propertyNames)
+
+	// Values are converted to the type of the existing column; new columns
+	// are added with the inferred type.
+	for _, propName := range propertyNames {
+		col := columns[propName]
+		if colType, ok := existingTypes[col]; ok {
+			propertyTypes[propName] = colType
+			continue
+		}
+		_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s",
+			identifier.Quote(tableName), identifier.Quote(col), propertyTypes[propName]))
+		if err != nil {
+			return nil, errors.ErrInternalServer
+		}
+	}
+
+	key := ""
+	if mode == ModeUpsert {
+		for _, col := range columns {
+			if col == keyColumn || col == identifier.Normalize(keyColumn) {
+				key = col
+			}
+		}
+		if key == "" {
+			return nil, errors.ErrInvalidInput
+		}
+	}
+
+	// The staging id numbers the features in the order they are copied for
+	// validateGeometries; it is not copied to the table.
+	const staging = "spatial_data_staging"
+	_, err = tx.Exec(fmt.Sprintf(`
+        CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT * FROM %s WITH NO DATA;
+        ALTER TABLE %s ALTER COLUMN geom TYPE GEOMETRY,
+            ALTER COLUMN id SET NOT NULL,
+            ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+    `, staging, identifier.Quote(tableName), staging))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	positions, err := s.copyFeatures(tx, staging, ds, propertyNames, columns, propertyTypes, username, func(int) {})
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET geom = ST_Transform(geom, %d)", staging, srid))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	issues, err := validateGeometries(tx, staging, tableName, geometryMode, positions)
+	if err != nil {
+		return nil, err
+	}
+
+	geomType, err := tableGeometryType(tx, tableName)
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if err := conformStagedGeometries(tx, staging, tableName, geomType); err != nil {
+		return nil, err
+	}
+
+	insertCols := []string{"geom", "created_by", "updated_by"}
+	for _, propName := range propertyNames {
+		insertCols = append(insertCols, identifier.Quote(columns[propName]))
+	}
+	colList := strings.Join(insertCols, ", ")
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s s",
+		identifier.Quote(tableName), colList, colList, staging)
+
+	result := &EditResult{GeometryIssues: issues}
+	switch mode {
+	case ModeReplace:
+		if _, err := tx.Exec(fmt.Sprintf("TRUNCATE TABLE %s", identifier.Quote(tableName))); err != nil {
+			return nil, errors.ErrInternalServer
+		}
+		fallthrough
+	case ModeAppend:
+		res, err := tx.Exec(insertSQL)
+		if err != nil {
+			return nil, errors.ErrInternalServer
+		}
+		result.Inserted, _ = res.RowsAffected()
+	case ModeUpsert:
+		if err := upsertStaged(tx, tableName, staging, key, propertyNames, columns, insertSQL, username, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("ANALYZE %s", identifier.Quote(tableName))); err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	return result, nil
+}
+
+// upsertStaged updates the rows of tableName whose key matches a staged row
+// and has different values, and inserts the staged rows with no match.
+func upsertStaged(tx *sqlx.Tx, tableName, staging, key string, propertyNames []string, columns map[string]string, insertSQL, username string, result *EditResult) error {
+	table, quotedKey := identifier.Quote(tableName), identifier.Quote(key)
+
+	var duplicates bool
+	err := tx.Get(&duplicates, fmt.Sprintf(
+		"SELECT EXISTS (SELECT 1 FROM %s WHERE %s IS NOT NULL GROUP BY %s HAVING count(*) > 1)",
+		staging, quotedKey, quotedKey))
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	if duplicates {
+		return errors.ErrInvalidInput
+	}
+
+	var matched int64
+	err = tx.Get(&matched, fmt.Sprintf(
+		"SELECT count(*) FROM %s s WHERE EXISTS (SELECT 1 FROM %s t WHERE t.%s = s.%s)",
+		staging, table, quotedKey, quotedKey))
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+
+	sets := []string{"geom = s.geom", "updated_at = CURRENT_TIMESTAMP", "updated_by = $1"}
+	oldValues := []string{"ST_AsEWKB(t.geom)"}
+	newValues := []string{"ST_AsEWKB(s.geom)"}
+	for _, propName := range propertyNames {
+		col := identifier.Quote(columns[propName])
+		sets = append(sets, fmt.Sprintf("%s = s.%s", col, col))
+		oldValues = append(oldValues, "t."+col)
+		newValues = append(newValues, "s."+col)
+	}
+	res, err := tx.Exec(fmt.Sprintf(`
+        UPDATE %s t SET %s
+        FROM %s s
+        WHERE t.%s = s.%s AND (%s) IS DISTINCT FROM (%s)
+    `, table, strings.Join(sets, ", "), staging, quotedKey, quotedKey,
+		strings.Join(oldValues, ", "), strings.Join(newValues, ", ")), username)
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	result.Updated, _ = res.RowsAffected()
+	result.Unchanged = matched - result.Updated
+
+	res, err = tx.Exec(fmt.Sprintf("%s WHERE NOT EXISTS (SELECT 1 FROM %s t WHERE t.%s = s.%s)",
+		insertSQL, table, quotedKey, quotedKey))
+	if err != nil {
+		return errors.ErrInternalServer
+	}
+	result.Inserted, _ = res.RowsAffected()
+
+	return nil
+}
+
+// tableColumn is an attribute column of a spatial data table.
+type tableColumn struct {
+	Name     string `db:"column_name"`
+	DataType string `db:"data_type"`
+}
+
+// tableColumns lists the attribute columns of tableName, leaving out id, geom
+// and the audit columns.
+func tableColumns(q sqlx.Queryer, tableName string) ([]tableColumn, error) {
+	var columns []tableColumn
+	err := sqlx.Select(q, &columns, `
+        SELECT column_name, data_type FROM information_schema.columns
+        WHERE table_name = $1 AND column_name <> ALL ($2)
+        ORDER BY ordinal_position
+    `, tableName, pq.StringArray(identifier.ReservedColumns))
+	return columns, err
+}
+
+// postgresColumnType maps an information_schema data type to the type names
+// understood by utils.ConvertToType.
+func postgresColumnType(dataType string) string {
+	switch strings.ToLower(dataType) {
+	case "smallint", "integer":
+		return "INTEGER"
+	case "bigint":
+		return "BIGINT"
+	case "real", "double precision", "numeric":
+		return "DOUBLE PRECISION"
+	case "boolean":
+		return "BOOLEAN"
+	case "date":
+		return "DATE"
+	case "timestamp with time zone", "timestamp without time zone":
+		return "TIMESTAMP WITH TIME ZONE"
+	case "json", "jsonb":
+		return "JSONB"
+	default:
+		return "TEXT"
+	}
+}
@@ -0,0 +1,304 @@
+package spatialdata
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	shp "github.com/jonas-p/go-shp"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// parseShapefileZip reads a zipped ESRI Shapefile. The archive must contain
+// exactly one .shp with its .dbf; a .cpg, if present, names the DBF encoding
+// and a .prj the coordinate system.
+func parseShapefileZip(r io.ReaderAt, size int64) (ds *dataset, err error) {
+	// go-shp panics on some malformed headers instead of returning an error.
+	defer func() {
+		if rec := recover(); rec != nil {
+			ds, err = nil, fmt.Errorf("malformed shapefile: %v", rec)
+		}
+	}()
+
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]*zip.File)
+	var shpNames []string
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(f.Name))
+		stem := strings.TrimSuffix(f.Name, path.Ext(f.Name))
+		members[stem+ext] = f
+		if ext == ".shp" {
+			shpNames = append(shpNames, stem)
+		}
+	}
+
+	if len(shpNames) != 1 {
+		return nil, fmt.Errorf("archive must contain exactly one .shp file, found %d", len(shpNames))
+	}
+	stem := shpNames[0]
+
+	dbfFile, ok := members[stem+".dbf"]
+	if !ok {
+		return nil, fmt.Errorf("archive is missing %s.dbf", stem)
+	}
+
+	shpReader, err := members[stem+".shp"].Open()
+	if err != nil {
+		return nil, err
+	}
+	dbfReader, err := dbfFile.Open()
+	if err != nil {
+		shpReader.Close()
+		return nil, err
+	}
+
+	decoder := dbfDecoder(members[stem+".cpg"])
+
+	sr := shp.SequentialReaderFromExt(shpReader, dbfReader)
+	defer sr.Close()
+
+	fields := sr.Fields()
+	columnTypes := make(map[string]string, len(fields))
+	for _, field := range fields {
+		columnTypes[field.String()] = dbfColumnType(field)
+	}
+
+	ds = &dataset{ColumnTypes: columnTypes, SRID: prjSRID(members[stem+".prj"])}
+	for sr.Next() {
+		position, shape := sr.Shape()
+		geom := shapeToGeometry(shape)
+		if geom == nil {
+			continue
+		}
+
+		feature := geojson.NewFeature(geom)
+		for i, field := range fields {
+			value := dbfValue(field, sr.Attribute(i), decoder)
+			if value != nil {
+				feature.Properties[field.String()] = value
+			}
+		}
+		ds.add(position, feature)
+	}
+	if err := sr.Err(); err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// prjSRID returns the EPSG code of the .prj file, or 0 when the archive has
+// none or it is not recognised.
+func prjSRID(prj *zip.File) int {
+	if prj == nil {
+		return 0
+	}
+	rc, err := prj.Open()
+	if err != nil {
+		return 0
+	}
+	defer rc.Close()
+
+	wkt, err := io.ReadAll(rc)
+	if err != nil {
+		return 0
+	}
+	return sridFromPRJ(string(wkt))
+}
+
+// dbfDecoder returns the decoder named by the .cpg file, or nil when the
+// archive has none or names an unknown encoding.
+func dbfDecoder(cpg *zip.File) *encoding.Decoder {
+	if cpg == nil {
+		return nil
+	}
+	rc, err := cpg.Open()
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+
+	name, err := io.ReadAll(rc)
+	if err != nil {
+		return nil
+	}
+
+	label := strings.TrimSpace(string(name))
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		// ArcGIS writes bare code page numbers such as "1252".
+		enc, err = htmlindex.Get("windows-" + label)
+		if err != nil {
+			return nil
+		}
+	}
+	return enc.NewDecoder()
+}
+
+// dbfColumnType maps a DBF field definition to a Postgres column type.
+func dbfColumnType(field shp.Field) string {
+	switch field.Fieldtype {
+	case 'N':
+		if field.Precision > 0 {
+			return "DOUBLE PRECISION"
+		}
+		if field.Size < 10 {
+			return "INTEGER"
+		}
+		return "BIGINT"
+	case 'F':
+		return "DOUBLE PRECISION"
+	case 'L':
+		return "BOOLEAN"
+	case 'D':
+		return "DATE"
+	default:
+		return "TEXT"
+	}
+}
+
+// dbfValue converts a raw DBF attribute to a value accepted by
+// utils.ConvertToType for the field's column type. Blank values become nil.
+func dbfValue(field shp.Field, raw string, decoder *encoding.Decoder) interface{} {
+	raw = strings.TrimSpace(strings.TrimRight(raw, "\x00"))
+	if raw == "" || strings.Trim(raw, "*") == "" {
+		return nil
+	}
+
+	switch field.Fieldtype {
+	case 'N', 'F':
+		return raw
+	case 'L':
+		switch raw {
+		case "T", "t", "Y", "y":
+			return true
+		case "F", "f", "N", "n":
+			return false
+		default:
+			return nil
+		}
+	case 'D':
+		date, err := time.Parse("20060102", raw)
+		if err != nil {
+			return nil
+		}
+		return date
+	default:
+		if decoder != nil {
+			if decoded, err := decoder.String(raw); err == nil {
+				return decoded
+			}
+		}
+		if !utf8.ValidString(raw) {
+			// Legacy DBFs without a .cpg are usually Windows-1252.
+			decoded, _ := charmap.Windows1252.NewDecoder().String(raw)
+			return decoded
+		}
+		return raw
+	}
+}
+
+// shapeToGeometry converts a shapefile record to an orb geometry, dropping any
+// Z and M values. Null shapes return nil.
+func shapeToGeometry(shape shp.Shape) orb.Geometry {
+	switch s := shape.(type) {
+	case *shp.Point:
+		return orb.Point{s.X, s.Y}
+	case *shp.PointZ:
+		return orb.Point{s.X, s.Y}
+	case *shp.PointM:
+		return orb.Point{s.X, s.Y}
+	case *shp.MultiPoint:
+		return toMultiPoint(s.Points)
+	case *shp.MultiPointZ:
+		return toMultiPoint(s.Points)
+	case *shp.MultiPointM:
+		return toMultiPoint(s.Points)
+	case *shp.PolyLine:
+		return toLines(s.Parts, s.Points)
+	case *shp.PolyLineZ:
+		return toLines(s.Parts, s.Points)
+	case *shp.PolyLineM:
+		return toLines(s.Parts, s.Points)
+	case *shp.Polygon:
+		return toPolygons(s.Parts, s.Points)
+	case *shp.PolygonZ:
+		return toPolygons(s.Parts, s.Points)
+	case *shp.PolygonM:
+		return toPolygons(s.Parts, s.Points)
+	default:
+		return nil
+	}
+}
+
+func toMultiPoint(points []shp.Point) orb.Geometry {
+	mp := make(orb.MultiPoint, len(points))
+	for i, p := range points {
+		mp[i] = orb.Point{p.X, p.Y}
+	}
+	return mp
+}
+
+// splitParts cuts the flat point list of a shape into its parts.
+func splitParts(parts []int32, points []shp.Point) [][]orb.Point {
+	result := make([][]orb.Point, 0, len(parts))
+	for i, start := range parts {
+		end := int32(len(points))
+		if i+1 < len(parts) {
+			end = parts[i+1]
+		}
+		part := make([]orb.Point, 0, end-start)
+		for _, p := range points[start:end] {
+			part = append(part, orb.Point{p.X, p.Y})
+		}
+		result = append(result, part)
+	}
+	return result
+}
+
+func toLines(parts []int32, points []shp.Point) orb.Geometry {
+	lines := splitParts(parts, points)
+	if len(lines) == 1 {
+		return orb.LineString(lines[0])
+	}
+	mls := make(orb.MultiLineString, len(lines))
+	for i, line := range lines {
+		mls[i] = orb.LineString(line)
+	}
+	return mls
+}
+
+// toPolygons groups shapefile rings into polygons. Outer rings are stored
+// clockwise and each is followed by its counter-clockwise holes.
+func toPolygons(parts []int32, points []shp.Point) orb.Geometry {
+	var polygons orb.MultiPolygon
+	for _, part := range splitParts(parts, points) {
+		ring := orb.Ring(part)
+		if ring.Orientation() == orb.CCW && len(polygons) > 0 {
+			last := len(polygons) - 1
+			polygons[last] = append(polygons[last], ring)
+			continue
+		}
+		polygons = append(polygons, orb.Polygon{ring})
+	}
+
+	if len(polygons) == 1 {
+		return polygons[0]
+	}
+	return polygons
+}
@@ -0,0 +1,175 @@
+package spatialdata
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+)
+
+// What happens to an invalid geometry during an import, chosen with the
+// invalid_geometry upload option.
+const (
+	InvalidGeometryReject = "reject"
+	InvalidGeometryRepair = "repair"
+	InvalidGeometrySkip   = "skip"
+)
+
+// Actions recorded in a GeometryIssue.
+const (
+	ActionRejected = "rejected"
+	ActionRepaired = "repaired"
+	ActionSkipped  = "skipped"
+	ActionRemoved  = "removed"
+)
+
+// GeometryIssue is a feature whose geometry was changed or left out during an
+// import. Feature is the zero-based position of the feature in the layer, as
+// in the preview report, and Reason is the PostGIS validity reason.
+type GeometryIssue struct {
+	TableName string `json:"table_name"`
+	Feature   int64  `json:"feature"`
+	Reason    string `json:"reason"`
+	Action    string `json:"action"`
+}
+
+func (i GeometryIssue) String() string {
+	return fmt.Sprintf("%s: feature %d %s: %s", i.TableName, i.Feature, i.Action, i.Reason)
+}
+
+// InvalidGeometryError is returned when invalid_geometry is reject and the
+// upload has invalid geometries.
+type InvalidGeometryError struct {
+	Issues []GeometryIssue
+}
+
+func (e *InvalidGeometryError) Error() string {
+	return fmt.Sprintf("%d invalid geometries, first %s", len(e.Issues), e.Issues[0])
+}
+
+// checkInvalidGeometryMode returns the invalid_geometry option, defaulting
+// to repair.
+func checkInvalidGeometryMode(mode string) (string, error) {
+	switch strings.ToLower(mode) {
+	case "", InvalidGeometryRepair:
+		return InvalidGeometryRepair, nil
+	case InvalidGeometryReject:
+		return InvalidGeometryReject, nil
+	case InvalidGeometrySkip:
+		return InvalidGeometrySkip, nil
+	default:
+		return "", errors.ErrInvalidInput
+	}
+}
+
+// validateGeometries checks the geometries just loaded into table, whose id
+// numbers the features in the order they were copied, so that positions[id-1]
+// is a feature's position in the source. Empty geometries are removed;
+// invalid ones are rejected, repaired with ST_MakeValid or removed according
+// to mode. Issues are reported under tableName.
+func validateGeometries(tx *sqlx.Tx, table, tableName, mode string, positions []int) ([]GeometryIssue, error) {
+	issues := []GeometryIssue{}
+	position := func(id int64) int64 {
+		return int64(positions[id-1])
+	}
+	record := func(ids []int64, reason, action string) {
+		for _, id := range ids {
+			issues = append(issues, GeometryIssue{TableName: tableName, Feature: position(id), Reason: reason, Action: action})
+		}
+	}
+
+	var empty []int64
+	err := tx.Select(&empty, fmt.Sprintf("DELETE FROM %s WHERE geom IS NULL OR ST_IsEmpty(geom) RETURNING id", table))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	record(empty, "Empty geometry", ActionRemoved)
+
+	var invalid []struct {
+		ID     int64  `db:"id"`
+		Reason string `db:"reason"`
+	}
+	err = tx.Select(&invalid, fmt.Sprintf(
+		"SELECT id, ST_IsValidReason(geom) AS reason FROM %s WHERE NOT ST_IsValid(geom) ORDER BY id", table))
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+	if len(invalid) == 0 {
+		return issues, nil
+	}
+
+	action := map[string]string{
+		InvalidGeometryReject: ActionRejected,
+		InvalidGeometryRepair: ActionRepaired,
+		InvalidGeometrySkip:   ActionSkipped,
+	}[mode]
+
+	// A repair that leaves nothing of the geometry removes the feature.
+	var removed map[int64]bool
+	switch mode {
+	case InvalidGeometrySkip:
+		_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE NOT ST_IsValid(geom)", table))
+	case InvalidGeometryRepair:
+		// ST_CollectionExtract keeps the parts of the original dimension, so
+		// a repaired polygon does not turn into a collection with stray lines.
+		_, err = tx.Exec(fmt.Sprintf(`
+			UPDATE %s SET geom = ST_CollectionExtract(ST_MakeValid(geom), ST_Dimension(geom) + 1)
+			WHERE NOT ST_IsValid(geom)
+		`, table))
+		if err == nil {
+			var ids []int64
+			err = tx.Select(&ids, fmt.Sprintf("DELETE FROM %s WHERE ST_IsEmpty(geom) RETURNING id", table))
+			removed = make(map[int64]bool, len(ids))
+			for _, id := range ids {
+				removed[id] = true
+			}
+		}
+	}
+	if err != nil {
+		return nil, errors.ErrInternalServer
+	}
+
+	rejected := make([]GeometryIssue, 0, len(invalid))
+	for _, row := range invalid {
+		issue := GeometryIssue{TableName: tableName, Feature: position(row.ID), Reason: row.Reason, Action: action}
+		if removed[row.ID] {
+			issue.Action = ActionRemoved
+		}
+		issues = append(issues, issue)
+		rejected = append(rejected, issue)
+	}
+	if mode == InvalidGeometryReject {
+		return nil, &InvalidGeometryError{Issues: rejected}
+	}
+
+	return issues, nil
+}
+
+// invalidGeometries runs the import's validity check on geometries, given as
+// hex EWKB, after reprojecting them to targetSRID, and returns the
+// ST_IsValidReason of each invalid one by its index in geometries.
+func invalidGeometries(q sqlx.Queryer, geometries []string, targetSRID int) (map[int]string, error) {
+	var invalid []struct {
+		N      int    `db:"n"`
+		Reason string `db:"reason"`
+	}
+	err := sqlx.Select(q, &invalid, `
+		SELECT n, ST_IsValidReason(geom) AS reason
+		FROM (
+			SELECT n - 1 AS n, ST_Transform(hex::geometry, $2) AS geom
+			FROM unnest($1::text[]) WITH ORDINALITY AS g(hex, n)
+		) g
+		WHERE NOT ST_IsValid(geom)
+	`, pq.StringArray(geometries), targetSRID)
+	if err != nil {
+		return nil, err
+	}
+
+	reasons := make(map[int]string, len(invalid))
+	for _, row := range invalid {
+		reasons[row.N] = row.Reason
+	}
+	return reasons, nil
+}
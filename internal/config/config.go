@@ -3,17 +3,41 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-    DBHost     string
-    DBPort     string
-    DBUser     string
-    DBPassword string
-    DBName     string
-    ServerPort string
+    DBHost          string
+    DBPort          string
+    DBUser          string
+    DBPassword      string
+    DBName          string
+    ServerPort      string
+    // PublicBaseURL is the URL clients reach the server at, used in tile URLs.
+    PublicBaseURL   string
+    // UploadDir holds files of queued import jobs; empty means the OS temp dir.
+    UploadDir       string
+    ImportWorkers   int
+    // ImportBatchSize is the number of rows sent in one COPY during an import.
+    ImportBatchSize int
+    // StoreGeom3857 makes imports keep a Web Mercator copy of the geometry
+    // for tile generation.
+    StoreGeom3857   bool
+    // TileCache is the vector tile cache backend: memory, disk or none.
+    TileCache       string
+    // TileCacheSize is the number of tiles the memory cache holds.
+    TileCacheSize   int
+    // TileCacheDir holds the disk cache; empty means a directory in the OS
+    // temp dir.
+    TileCacheDir    string
+    // TileMaxAge and GeoJSONMaxAge are how long clients may reuse tiles and
+    // GeoJSON responses before revalidating them; zero means always
+    // revalidate.
+    TileMaxAge      time.Duration
+    GeoJSONMaxAge   time.Duration
 }
 
 func Load() *Config {
@@ -23,11 +47,49 @@ func Load() *Config {
     }
 
     return &Config{
-        DBHost:     os.Getenv("DB_HOST"),
-        DBPort:     os.Getenv("DB_PORT"),
-        DBUser:     os.Getenv("DB_USER"),
-        DBPassword: os.Getenv("DB_PASSWORD"),
-        DBName:     os.Getenv("DB_NAME"),
-        ServerPort: os.Getenv("SERVER_PORT"),
+        DBHost:          os.Getenv("DB_HOST"),
+        DBPort:          os.Getenv("DB_PORT"),
+        DBUser:          os.Getenv("DB_USER"),
+        DBPassword:      os.Getenv("DB_PASSWORD"),
+        DBName:          os.Getenv("DB_NAME"),
+        ServerPort:      os.Getenv("SERVER_PORT"),
+        PublicBaseURL:   getEnv("PUBLIC_BASE_URL", "http://localhost:8080"),
+        UploadDir:       os.Getenv("UPLOAD_DIR"),
+        ImportWorkers:   getEnvInt("IMPORT_WORKERS", 2),
+        ImportBatchSize: getEnvInt("IMPORT_BATCH_SIZE", 5000),
+        StoreGeom3857:   getEnvBool("STORE_GEOM_3857", false),
+        TileCache:       getEnv("TILE_CACHE", "memory"),
+        TileCacheSize:   getEnvInt("TILE_CACHE_SIZE", 10000),
+        TileCacheDir:    os.Getenv("TILE_CACHE_DIR"),
+        TileMaxAge:      time.Duration(getEnvInt("TILE_MAX_AGE", 60)) * time.Second,
+        GeoJSONMaxAge:   time.Duration(getEnvInt("GEOJSON_MAX_AGE", 0)) * time.Second,
     }
+}
+
+// getEnv reads an environment variable, returning fallback when it is unset.
+func getEnv(key, fallback string) string {
+    if value := os.Getenv(key); value != "" {
+        return value
+    }
+    return fallback
+}
+
+// getEnvInt reads an integer environment variable, returning fallback when it
+// is unset or invalid.
+func getEnvInt(key string, fallback int) int {
+    value, err := strconv.Atoi(os.Getenv(key))
+    if err != nil {
+        return fallback
+    }
+    return value
+}
+
+// getEnvBool reads a boolean environment variable, returning fallback when it
+// is unset or invalid.
+func getEnvBool(key string, fallback bool) bool {
+    value, err := strconv.ParseBool(os.Getenv(key))
+    if err != nil {
+        return fallback
+    }
+    return value
 }
\ No newline at end of file
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"deflate", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, br", "br"},
+		{"GZIP, deflate", "gzip"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br; q=0.8, gzip; q=0.8", "br"},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"br;q=0, *", "gzip"},
+		{"gzip;q=invalid", "gzip"},
+	}
+	for _, tt := range tests {
+		if got := acceptedEncoding(tt.header); got != tt.want {
+			t.Errorf("acceptedEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// testBody is long enough that a compressed response is told apart from an
+// uncompressed one.
+var testBody = strings.Repeat(`{"type":"Feature","geometry":null,"properties":{}}`, 100)
+
+func testRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Compress())
+	r.GET("/body", func(c *gin.Context) {
+		c.String(http.StatusOK, testBody)
+	})
+	r.HEAD("/body", func(c *gin.Context) {
+		c.Header("Content-Length", "5000")
+		c.Status(http.StatusOK)
+	})
+	r.GET("/encoded", func(c *gin.Context) {
+		c.Header("Content-Encoding", "gzip")
+		c.String(http.StatusOK, "already compressed")
+	})
+	r.GET("/not-modified", func(c *gin.Context) {
+		c.Status(http.StatusNotModified)
+	})
+	return r
+}
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		acceptEncoding string
+		wantStatus     int
+		wantEncoding   string
+		wantBody       string
+	}{
+		{name: "brotli", method: http.MethodGet, path: "/body", acceptEncoding: "gzip, br", wantStatus: http.StatusOK, wantEncoding: "br", wantBody: testBody},
+		{name: "gzip", method: http.MethodGet, path: "/body", acceptEncoding: "gzip", wantStatus: http.StatusOK, wantEncoding: "gzip", wantBody: testBody},
+		{name: "identity", method: http.MethodGet, path: "/body", acceptEncoding: "identity", wantStatus: http.StatusOK, wantBody: testBody},
+		{name: "no Accept-Encoding", method: http.MethodGet, path: "/body", wantStatus: http.StatusOK, wantBody: testBody},
+		{name: "already encoded", method: http.MethodGet, path: "/encoded", acceptEncoding: "br", wantStatus: http.StatusOK, wantEncoding: "gzip", wantBody: "already compressed"},
+		{name: "not modified", method: http.MethodGet, path: "/not-modified", acceptEncoding: "br", wantStatus: http.StatusNotModified},
+		{name: "head", method: http.MethodHead, path: "/body", acceptEncoding: "br", wantStatus: http.StatusOK},
+	}
+	r := testRouter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			encoding := w.Header().Get("Content-Encoding")
+			if encoding != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", encoding, tt.wantEncoding)
+			}
+
+			var body io.Reader = w.Body
+			switch {
+			case tt.path == "/encoded":
+			case encoding == "br":
+				body = brotli.NewReader(w.Body)
+			case encoding == "gzip":
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.wantBody {
+				t.Errorf("body = %.40q (%d bytes), want %.40q (%d bytes)", got, len(got), tt.wantBody, len(tt.wantBody))
+			}
+		})
+	}
+}
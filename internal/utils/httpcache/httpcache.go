@@ -0,0 +1,62 @@
+// Package httpcache sets HTTP caching headers from the time a dataset was
+// last modified and answers conditional requests.
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag returns the validator of a dataset version. It is weak, as the
+// representation varies with the compression.
+func ETag(modified time.Time) string {
+	return fmt.Sprintf(`W/"%x"`, modified.UnixNano())
+}
+
+// NotModified sets the ETag, Last-Modified and Cache-Control headers of a
+// response built from data last modified at modified, which clients may reuse
+// for maxAge before revalidating. When the request's If-None-Match or
+// If-Modified-Since show the client has this version, it answers 304 and
+// returns true.
+func NotModified(c *gin.Context, modified time.Time, maxAge time.Duration) bool {
+	etag := ETag(modified)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	if maxAge > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since.
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if matchesETag(match, etag) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+	if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil {
+		if !modified.Truncate(time.Second).After(since) {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// matchesETag compares an If-None-Match list with etag, ignoring weakness.
+func matchesETag(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestETag(t *testing.T) {
+	modified := time.Unix(1, 255)
+	if got, want := ETag(modified), `W/"3b9acaff"`; got != want {
+		t.Errorf("ETag() = %s, want %s", got, want)
+	}
+	if ETag(modified) == ETag(modified.Add(time.Nanosecond)) {
+		t.Error("ETag() is the same for different versions")
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 500_000_000, time.UTC)
+	etag := ETag(modified)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		maxAge  time.Duration
+		want    bool
+	}{
+		{name: "unconditional", want: false},
+		{name: "matching etag", headers: map[string]string{"If-None-Match": etag}, want: true},
+		{name: "strong form of etag", headers: map[string]string{"If-None-Match": etag[2:]}, want: true},
+		{name: "etag in list", headers: map[string]string{"If-None-Match": `"other", ` + etag}, want: true},
+		{name: "any etag", headers: map[string]string{"If-None-Match": "*"}, want: true},
+		{name: "other etag", headers: map[string]string{"If-None-Match": `W/"other"`}, want: false},
+		{
+			name: "etag wins over date",
+			headers: map[string]string{
+				"If-None-Match":     `W/"other"`,
+				"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat),
+			},
+			want: false,
+		},
+		{name: "same second", headers: map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, want: true},
+		{name: "later date", headers: map[string]string{"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)}, want: true},
+		{name: "earlier date", headers: map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, want: false},
+		{name: "invalid date", headers: map[string]string{"If-Modified-Since": "yesterday"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			for key, value := range tt.headers {
+				c.Request.Header.Set(key, value)
+			}
+
+			got := NotModified(c, modified, tt.maxAge)
+			c.Writer.WriteHeaderNow()
+			if got != tt.want {
+				t.Errorf("NotModified() = %v, want %v", got, tt.want)
+			}
+			if tt.want && w.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want 304", w.Code)
+			}
+			if !tt.want && w.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", w.Code)
+			}
+			if w.Header().Get("ETag") != etag {
+				t.Errorf("ETag = %s, want %s", w.Header().Get("ETag"), etag)
+			}
+			if got, want := w.Header().Get("Last-Modified"), "Wed, 01 May 2024 10:00:00 GMT"; got != want {
+				t.Errorf("Last-Modified = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestNotModifiedCacheControl(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		maxAge time.Duration
+		want   string
+	}{
+		{0, "no-cache"},
+		{time.Minute, "public, max-age=60"},
+		{90 * time.Second, "public, max-age=90"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		NotModified(c, time.Now(), tt.maxAge)
+		if got := w.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("Cache-Control for %v = %s, want %s", tt.maxAge, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package identifier turns user supplied names, such as upload table names and
+// property keys, into safe Postgres identifiers.
+package identifier
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+	"github.com/samdyra/go-geo/internal/utils/errors"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxLength is the longest identifier Postgres keeps (NAMEDATALEN - 1). The
+// table_name columns of spatial_data and import_job are as wide, so any table
+// name returned here can be stored.
+const maxLength = 63
+
+// ReservedColumns are the columns every spatial data table has, or may have
+// in the case of geom_3857; properties with these names are renamed.
+var ReservedColumns = []string{"id", "geom", "geom_3857", "created_at", "updated_at", "created_by", "updated_by"}
+
+// systemColumns are hidden columns Postgres adds to every table.
+var systemColumns = []string{"tableoid", "xmin", "cmin", "xmax", "cmax", "ctid"}
+
+// keywords are the Postgres key words that are reserved, or reserved except as
+// function or type names, and so cannot be used as unquoted identifiers.
+var keywords = map[string]bool{
+	"all": true, "analyse": true, "analyze": true, "and": true, "any": true, "array": true,
+	"as": true, "asc": true, "asymmetric": true, "authorization": true, "binary": true,
+	"both": true, "case": true, "cast": true, "check": true, "collate": true,
+	"collation": true, "column": true, "concurrently": true, "constraint": true,
+	"create": true, "cross": true, "current_catalog": true, "current_date": true,
+	"current_role": true, "current_schema": true, "current_time": true,
+	"current_timestamp": true, "current_user": true, "default": true, "deferrable": true,
+	"desc": true, "distinct": true, "do": true, "else": true, "end": true, "except": true,
+	"false": true, "fetch": true, "for": true, "foreign": true, "freeze": true, "from": true,
+	"full": true, "grant": true, "group": true, "having": true, "ilike": true, "in": true,
+	"initially": true, "inner": true, "intersect": true, "into": true, "is": true,
+	"isnull": true, "join": true, "lateral": true, "leading": true, "left": true,
+	"like": true, "limit": true, "localtime": true, "localtimestamp": true, "natural": true,
+	"not": true, "notnull": true, "null": true, "offset": true, "on": true, "only": true,
+	"or": true, "order": true, "outer": true, "overlaps": true, "placing": true,
+	"primary": true, "references": true, "returning": true, "right": true, "select": true,
+	"session_user": true, "similar": true, "some": true, "symmetric": true,
+	"system_user": true, "table": true, "tablesample": true, "then": true, "to": true,
+	"trailing": true, "true": true, "union": true, "unique": true, "user": true,
+	"using": true, "variadic": true, "verbose": true, "when": true, "where": true,
+	"window": true, "with": true,
+}
+
+var separatorChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Normalize lowercases name, strips accents and replaces every run of other
+// characters with an underscore, so "Luas (Ha)" becomes "luas_ha". Names
+// starting with a digit get a leading underscore and reserved key words a
+// trailing one. The result is empty if name has no letters or digits.
+func Normalize(name string) string {
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), name)
+	if err == nil {
+		name = stripped
+	}
+
+	name = separatorChars.ReplaceAllString(strings.ToLower(name), "_")
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return ""
+	}
+
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	if len(name) > maxLength {
+		name = strings.TrimRight(name[:maxLength], "_")
+	}
+	if keywords[name] {
+		name = truncate(name, maxLength-1) + "_"
+	}
+	return name
+}
+
+// Table normalises a table name supplied by a user. It returns
+// errors.ErrInvalidInput if nothing usable is left.
+func Table(name string) (string, error) {
+	name = Normalize(name)
+	if name == "" {
+		return "", errors.ErrInvalidInput
+	}
+	return name, nil
+}
+
+// Columns maps each property name to a unique column name. Names that
+// normalise to the same column, or to one of the ReservedColumns, get a
+// numeric suffix; names with no usable characters become "column".
+func Columns(names []string) map[string]string {
+	taken := make(map[string]bool)
+	for _, col := range ReservedColumns {
+		taken[col] = true
+	}
+	for _, col := range systemColumns {
+		taken[col] = true
+	}
+
+	columns := make(map[string]string, len(names))
+	for _, name := range names {
+		base := Normalize(name)
+		if base == "" {
+			base = "column"
+		}
+
+		col := base
+		for i := 2; taken[col]; i++ {
+			suffix := "_" + strconv.Itoa(i)
+			col = truncate(base, maxLength-len(suffix)) + suffix
+		}
+		taken[col] = true
+		columns[name] = col
+	}
+
+	return columns
+}
+
+// Quote quotes name for use as an identifier in a SQL statement.
+func Quote(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+func truncate(name string, length int) string {
+	if len(name) > length {
+		return name[:length]
+	}
+	return name
+}
@@ -0,0 +1,147 @@
+package identifier
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Luas (Ha)", "luas_ha"},
+		{"jalan", "jalan"},
+		{"  __Jalan__ ", "jalan"},
+		{"Kecamatan Cikajang", "kecamatan_cikajang"},
+		{"Kéçamatàn", "kecamatan"},
+		{"Jalan Ñandú", "jalan_nandu"},
+		{"2024 data", "_2024_data"},
+		{"select", "select_"},
+		{"Order", "order_"},
+		{"user", "user_"},
+		{"username", "username"},
+		{"日本語", ""},
+		{"!!!", ""},
+		{"", ""},
+		{"Robert'); DROP TABLE students;--", "robert_drop_table_students"},
+		{`a"b`, "a_b"},
+		{"a\x00b", "a_b"},
+		// Identifiers are cut to 63 bytes, without a trailing underscore.
+		{strings.Repeat("a", 70), strings.Repeat("a", 63)},
+		{strings.Repeat("a", 62) + "_b", strings.Repeat("a", 62)},
+		{strings.Repeat("é", 70), strings.Repeat("e", 63)},
+		{strings.Repeat("日", 10) + strings.Repeat("b", 70), strings.Repeat("b", 63)},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.name); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := Normalize(tt.name); len(got) > maxLength {
+			t.Errorf("Normalize(%q) is %d bytes long", tt.name, len(got))
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "Data Jalan 2024", want: "data_jalan_2024"},
+		{name: "Table", want: "table_"},
+		{name: "jalan; DROP TABLE users", want: "jalan_drop_table_users"},
+		{name: "", wantErr: true},
+		{name: "---", wantErr: true},
+		{name: "日本語", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Table(tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Table(%q) = %q, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Table(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  map[string]string
+	}{
+		{
+			name:  "distinct",
+			names: []string{"Nama", "Luas (Ha)"},
+			want:  map[string]string{"Nama": "nama", "Luas (Ha)": "luas_ha"},
+		},
+		{
+			name:  "collisions after normalization",
+			names: []string{"Nama", "nama", "NAMA!", "Náma"},
+			want:  map[string]string{"Nama": "nama", "nama": "nama_2", "NAMA!": "nama_3", "Náma": "nama_4"},
+		},
+		{
+			name:  "reserved and system columns",
+			names: []string{"id", "geom", "Created At", "xmin", "ctid"},
+			want:  map[string]string{"id": "id_2", "geom": "geom_2", "Created At": "created_at_2", "xmin": "xmin_2", "ctid": "ctid_2"},
+		},
+		{
+			name:  "a suffix does not collide with a later name",
+			names: []string{"kode", "Kode", "kode_2"},
+			want:  map[string]string{"kode": "kode", "Kode": "kode_2", "kode_2": "kode_2_2"},
+		},
+		{
+			name:  "no usable characters",
+			names: []string{"", "日本", "?"},
+			want:  map[string]string{"": "column", "日本": "column_2", "?": "column_3"},
+		},
+		{
+			name:  "suffixed names stay within the length limit",
+			names: []string{strings.Repeat("a", 70) + "1", strings.Repeat("a", 70) + "2", strings.Repeat("é", 70)},
+			want: map[string]string{
+				strings.Repeat("a", 70) + "1": strings.Repeat("a", 63),
+				strings.Repeat("a", 70) + "2": strings.Repeat("a", 61) + "_2",
+				strings.Repeat("é", 70):       strings.Repeat("e", 63),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Columns(tt.names)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Columns(%q) = %v, want %v", tt.names, got, tt.want)
+			}
+			for name, col := range got {
+				if len(col) > maxLength {
+					t.Errorf("column of %q is %d bytes long", name, len(col))
+				}
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"jalan", `"jalan"`},
+		{"Kode Desa", `"Kode Desa"`},
+		{`a"b`, `"a""b"`},
+		{`x"; DROP TABLE users; --`, `"x""; DROP TABLE users; --"`},
+		{`""`, `""""""`},
+		{"a\x00b", `"a"`},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.name); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
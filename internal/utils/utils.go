@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ParseCoordinate converts a slice of two strings to a slice of two float64 values
@@ -36,7 +39,7 @@ func FormatTableName(tableName string) string {
 
 // GetLayerType returns the appropriate layer type based on the data type
 func GetLayerType(dataType string) string {
-    switch dataType {
+    switch geometryFamily(dataType) {
     case "LINESTRING":
         return "line"
     case "POLYGON":
@@ -48,9 +51,15 @@ func GetLayerType(dataType string) string {
     }
 }
 
+// geometryFamily maps a geometry type such as MULTIPOLYGON to POLYGON, so
+// single and multi geometries are styled alike.
+func geometryFamily(dataType string) string {
+    return strings.TrimPrefix(strings.ToUpper(dataType), "MULTI")
+}
+
 // GetPaint returns the appropriate paint configuration based on the data type and color
 func GetPaint(dataType, color string) map[string]interface{} {
-    switch dataType {
+    switch geometryFamily(dataType) {
     case "LINESTRING":
         return map[string]interface{}{
             "line-color":   color,
@@ -78,48 +87,204 @@ func GetPaint(dataType, color string) map[string]interface{} {
     }
 }
 
+// InferPostgresType returns the narrowest column type that can hold value.
+// Whole numbers are BIGINT, strings holding a date or timestamp are DATE or
+// TIMESTAMP WITH TIME ZONE, and objects and arrays are JSONB. A nil value
+// returns "", which ReconcileTypes ignores.
 func InferPostgresType(value interface{}) string {
-    switch value.(type) {
+    switch v := value.(type) {
+    case nil:
+        return ""
     case float64:
+        if v == math.Trunc(v) && math.Abs(v) <= maxExactFloatInt {
+            return "BIGINT"
+        }
         return "DOUBLE PRECISION"
+    case int, int64:
+        return "BIGINT"
     case bool:
         return "BOOLEAN"
+    case time.Time:
+        return "TIMESTAMP WITH TIME ZONE"
+    case map[string]interface{}, []interface{}:
+        return "JSONB"
+    case string:
+        if _, ok := ParseDate(v); ok {
+            return "DATE"
+        }
+        if _, ok := ParseTimestamp(v); ok {
+            return "TIMESTAMP WITH TIME ZONE"
+        }
+        return "TEXT"
     default:
         return "TEXT"
     }
 }
 
+// maxExactFloatInt is the largest integer a float64 holds exactly (2^53).
+const maxExactFloatInt = 1 << 53
+
+// dateLayouts are the date formats recognised in text values. Slashed and
+// dashed dates are read day first, as they are written in Indonesia.
+var dateLayouts = []string{
+    "2006-01-02",
+    "2006/01/02",
+    "02/01/2006",
+    "2/1/2006",
+    "02-01-2006",
+    "2-1-2006",
+    "02.01.2006",
+}
+
+// timestampLayouts are the timestamp formats recognised in text values.
+// Timestamps without a zone are taken as UTC.
+var timestampLayouts = []string{
+    time.RFC3339Nano,
+    "2006-01-02T15:04:05",
+    "2006-01-02 15:04:05Z07:00",
+    "2006-01-02 15:04:05",
+    "2006-01-02 15:04",
+    "02/01/2006 15:04:05",
+    "02/01/2006 15:04",
+}
+
+// ParseDate parses text in one of the recognised date formats.
+func ParseDate(text string) (time.Time, bool) {
+    return parseTime(text, dateLayouts)
+}
+
+// ParseTimestamp parses text in one of the recognised timestamp formats.
+func ParseTimestamp(text string) (time.Time, bool) {
+    return parseTime(text, timestampLayouts)
+}
+
+func parseTime(text string, layouts []string) (time.Time, bool) {
+    text = strings.TrimSpace(text)
+    // Every layout starts with a digit; this keeps plain text cheap.
+    if text == "" || text[0] < '0' || text[0] > '9' {
+        return time.Time{}, false
+    }
+    for _, layout := range layouts {
+        if t, err := time.Parse(layout, text); err == nil {
+            return t, true
+        }
+    }
+    return time.Time{}, false
+}
+
+// ParseTextValue converts a value read from a text format such as CSV into
+// the Go type InferPostgresType expects. Empty strings become nil, and
+// numbers with leading zeros stay text so codes keep their digits.
+func ParseTextValue(text string) interface{} {
+    text = strings.TrimSpace(text)
+    if text == "" {
+        return nil
+    }
+
+    switch strings.ToLower(text) {
+    case "true":
+        return true
+    case "false":
+        return false
+    }
+
+    if len(text) > 1 && text[0] == '0' && text[1] != '.' {
+        return text
+    }
+    if !strings.ContainsAny(text, "0123456789") {
+        return text
+    }
+    if f, err := strconv.ParseFloat(text, 64); err == nil {
+        return f
+    }
+
+    return text
+}
+
+// ReconcileTypes returns a column type that can hold values of both types,
+// falling back to TEXT. An empty type, from a nil value, is ignored.
 func ReconcileTypes(existingType, newType string) string {
-    if existingType == newType {
+    if existingType == "" {
+        return newType
+    }
+    if newType == "" || existingType == newType {
         return existingType
     }
-    if (existingType == "INTEGER" && newType == "DOUBLE PRECISION") ||
-       (existingType == "DOUBLE PRECISION" && newType == "INTEGER") {
-        return "DOUBLE PRECISION"
+
+    numeric := map[string]int{"INTEGER": 1, "BIGINT": 2, "DOUBLE PRECISION": 3}
+    if numeric[existingType] > 0 && numeric[newType] > 0 {
+        if numeric[existingType] > numeric[newType] {
+            return existingType
+        }
+        return newType
     }
-    if existingType == "TEXT" || newType == "TEXT" {
-        return "TEXT"
+    if (existingType == "DATE" && newType == "TIMESTAMP WITH TIME ZONE") ||
+       (existingType == "TIMESTAMP WITH TIME ZONE" && newType == "DATE") {
+        return "TIMESTAMP WITH TIME ZONE"
     }
     return "TEXT"
 }
 
+// columnTypeAliases maps the type names accepted from users to the types
+// ConvertToType understands.
+var columnTypeAliases = map[string]string{
+    "INTEGER":                  "INTEGER",
+    "INT":                      "INTEGER",
+    "INT4":                     "INTEGER",
+    "BIGINT":                   "BIGINT",
+    "INT8":                     "BIGINT",
+    "DOUBLE PRECISION":         "DOUBLE PRECISION",
+    "DOUBLE":                   "DOUBLE PRECISION",
+    "FLOAT":                    "DOUBLE PRECISION",
+    "FLOAT8":                   "DOUBLE PRECISION",
+    "BOOLEAN":                  "BOOLEAN",
+    "BOOL":                     "BOOLEAN",
+    "TEXT":                     "TEXT",
+    "DATE":                     "DATE",
+    "TIMESTAMP WITH TIME ZONE": "TIMESTAMP WITH TIME ZONE",
+    "TIMESTAMPTZ":              "TIMESTAMP WITH TIME ZONE",
+    "JSONB":                    "JSONB",
+    "JSON":                     "JSONB",
+}
+
+// NormalizeColumnType returns the canonical name of a column type given by a
+// user, such as "timestamptz", and false if the type is not supported.
+func NormalizeColumnType(name string) (string, bool) {
+    colType, ok := columnTypeAliases[strings.Join(strings.Fields(strings.ToUpper(name)), " ")]
+    return colType, ok
+}
+
 func ConvertToType(value interface{}, targetType string) (interface{}, error) {
+    // A nil value, such as a JSON null, is NULL whatever the column type.
+    if value == nil {
+        return nil, nil
+    }
+
     switch targetType {
-    case "INTEGER":
+    case "INTEGER", "BIGINT":
         switch v := value.(type) {
+        case int64:
+            return v, nil
+        case int:
+            return int64(v), nil
         case float64:
+            if v != math.Trunc(v) {
+                return nil, fmt.Errorf("cannot convert %v to %s", value, targetType)
+            }
             return int64(v), nil
         case string:
-            return strconv.ParseInt(v, 10, 64)
+            return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
         default:
-            return nil, fmt.Errorf("cannot convert %v to INTEGER", value)
+            return nil, fmt.Errorf("cannot convert %v to %s", value, targetType)
         }
     case "DOUBLE PRECISION":
         switch v := value.(type) {
         case float64:
             return v, nil
+        case int64:
+            return float64(v), nil
         case string:
-            return strconv.ParseFloat(v, 64)
+            return strconv.ParseFloat(strings.TrimSpace(v), 64)
         default:
             return nil, fmt.Errorf("cannot convert %v to DOUBLE PRECISION", value)
         }
@@ -128,13 +293,68 @@ func ConvertToType(value interface{}, targetType string) (interface{}, error) {
         case bool:
             return v, nil
         case string:
-            return strconv.ParseBool(v)
+            return strconv.ParseBool(strings.TrimSpace(v))
         default:
             return nil, fmt.Errorf("cannot convert %v to BOOLEAN", value)
         }
+    case "DATE":
+        switch v := value.(type) {
+        case time.Time:
+            return v, nil
+        case string:
+            if t, ok := ParseDate(v); ok {
+                return t, nil
+            }
+            if t, ok := ParseTimestamp(v); ok {
+                return t, nil
+            }
+            return nil, fmt.Errorf("cannot convert %q to DATE", v)
+        default:
+            return nil, fmt.Errorf("cannot convert %v to DATE", value)
+        }
+    case "TIMESTAMP WITH TIME ZONE":
+        switch v := value.(type) {
+        case time.Time:
+            return v, nil
+        case string:
+            if t, ok := ParseTimestamp(v); ok {
+                return t, nil
+            }
+            if t, ok := ParseDate(v); ok {
+                return t, nil
+            }
+            return nil, fmt.Errorf("cannot convert %q to TIMESTAMP WITH TIME ZONE", v)
+        default:
+            return nil, fmt.Errorf("cannot convert %v to TIMESTAMP WITH TIME ZONE", value)
+        }
+    case "JSONB":
+        if v, ok := value.(string); ok {
+            if !json.Valid([]byte(v)) {
+                return nil, fmt.Errorf("cannot convert %q to JSONB", v)
+            }
+            return v, nil
+        }
+        data, err := json.Marshal(value)
+        if err != nil {
+            return nil, err
+        }
+        return string(data), nil
     case "TEXT":
+        switch v := value.(type) {
+        case float64:
+            // %v would print large numbers such as codes in exponent form.
+            return strconv.FormatFloat(v, 'f', -1, 64), nil
+        case time.Time:
+            return v.Format(time.RFC3339), nil
+        case map[string]interface{}, []interface{}:
+            data, err := json.Marshal(v)
+            if err != nil {
+                return nil, err
+            }
+            return string(data), nil
+        }
         return fmt.Sprintf("%v", value), nil
     default:
         return nil, fmt.Errorf("unknown target type: %s", targetType)
     }
-}
\ No newline at end of file
+}
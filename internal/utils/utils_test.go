@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInferPostgresType(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{float64(42), "BIGINT"},
+		{float64(-7), "BIGINT"},
+		{1.5, "DOUBLE PRECISION"},
+		{float64(1 << 60), "DOUBLE PRECISION"},
+		{int64(3), "BIGINT"},
+		{3, "BIGINT"},
+		{true, "BOOLEAN"},
+		{time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), "TIMESTAMP WITH TIME ZONE"},
+		{"2024-05-01", "DATE"},
+		{"01/05/2024", "DATE"},
+		{"2024-05-01T10:30:00Z", "TIMESTAMP WITH TIME ZONE"},
+		{"2024-05-01 10:30", "TIMESTAMP WITH TIME ZONE"},
+		{"Bandung", "TEXT"},
+		{"2024-13-01", "TEXT"},
+		{"", "TEXT"},
+		{map[string]interface{}{"a": 1.0}, "JSONB"},
+		{[]interface{}{1.0, "a"}, "JSONB"},
+	}
+	for _, tt := range tests {
+		if got := InferPostgresType(tt.value); got != tt.want {
+			t.Errorf("InferPostgresType(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestReconcileTypes(t *testing.T) {
+	tests := []struct {
+		existingType, newType string
+		want                  string
+	}{
+		{"", "", ""},
+		{"", "BIGINT", "BIGINT"},
+		{"BIGINT", "", "BIGINT"},
+		{"TEXT", "TEXT", "TEXT"},
+		{"INTEGER", "BIGINT", "BIGINT"},
+		{"BIGINT", "DOUBLE PRECISION", "DOUBLE PRECISION"},
+		{"DOUBLE PRECISION", "BIGINT", "DOUBLE PRECISION"},
+		{"DATE", "TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITH TIME ZONE"},
+		{"TIMESTAMP WITH TIME ZONE", "DATE", "TIMESTAMP WITH TIME ZONE"},
+		{"BIGINT", "BOOLEAN", "TEXT"},
+		{"DATE", "BIGINT", "TEXT"},
+		{"JSONB", "TEXT", "TEXT"},
+	}
+	for _, tt := range tests {
+		if got := ReconcileTypes(tt.existingType, tt.newType); got != tt.want {
+			t.Errorf("ReconcileTypes(%q, %q) = %q, want %q", tt.existingType, tt.newType, got, tt.want)
+		}
+	}
+}
+
+// TestInferAndReconcileWithNulls checks that a null among numbers leaves the
+// column numeric and that the null is then written as NULL.
+func TestInferAndReconcileWithNulls(t *testing.T) {
+	colType := ""
+	values := []interface{}{float64(1), nil, float64(3)}
+	for _, value := range values {
+		colType = ReconcileTypes(colType, InferPostgresType(value))
+	}
+	if colType != "BIGINT" {
+		t.Fatalf("column type = %q, want BIGINT", colType)
+	}
+	for _, value := range values {
+		if _, err := ConvertToType(value, colType); err != nil {
+			t.Errorf("ConvertToType(%#v, %s): %v", value, colType, err)
+		}
+	}
+}
+
+func TestConvertToType(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	moment := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		value      interface{}
+		targetType string
+		want       interface{}
+		wantErr    bool
+	}{
+		{value: nil, targetType: "BIGINT", want: nil},
+		{value: nil, targetType: "TEXT", want: nil},
+		{value: nil, targetType: "JSONB", want: nil},
+		{value: nil, targetType: "DATE", want: nil},
+		{value: float64(42), targetType: "BIGINT", want: int64(42)},
+		{value: float64(1 << 53), targetType: "BIGINT", want: int64(1 << 53)},
+		{value: 1.5, targetType: "BIGINT", wantErr: true},
+		{value: " 12 ", targetType: "INTEGER", want: int64(12)},
+		{value: "12a", targetType: "INTEGER", wantErr: true},
+		{value: true, targetType: "BIGINT", wantErr: true},
+		{value: int64(2), targetType: "DOUBLE PRECISION", want: 2.0},
+		{value: "2.5", targetType: "DOUBLE PRECISION", want: 2.5},
+		{value: "ya", targetType: "BOOLEAN", wantErr: true},
+		{value: "true", targetType: "BOOLEAN", want: true},
+		{value: "2024-05-01", targetType: "DATE", want: day},
+		{value: "01/05/2024", targetType: "DATE", want: day},
+		{value: "kemarin", targetType: "DATE", wantErr: true},
+		{value: "2024-05-01T10:30:00Z", targetType: "TIMESTAMP WITH TIME ZONE", want: moment},
+		{value: "2024-05-01", targetType: "TIMESTAMP WITH TIME ZONE", want: day},
+		{value: float64(1), targetType: "TIMESTAMP WITH TIME ZONE", wantErr: true},
+		{value: map[string]interface{}{"a": 1.0}, targetType: "JSONB", want: `{"a":1}`},
+		{value: []interface{}{"a", 2.0}, targetType: "JSONB", want: `["a",2]`},
+		{value: `{"a": 1}`, targetType: "JSONB", want: `{"a": 1}`},
+		{value: `{"a": `, targetType: "JSONB", wantErr: true},
+		{value: float64(3201012345678), targetType: "TEXT", want: "3201012345678"},
+		{value: moment, targetType: "TEXT", want: "2024-05-01T10:30:00Z"},
+		{value: map[string]interface{}{"a": 1.0}, targetType: "TEXT", want: `{"a":1}`},
+		{value: true, targetType: "TEXT", want: "true"},
+		{value: "x", targetType: "GEOMETRY", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ConvertToType(tt.value, tt.targetType)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ConvertToType(%#v, %s) = %#v, want an error", tt.value, tt.targetType, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ConvertToType(%#v, %s): %v", tt.value, tt.targetType, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ConvertToType(%#v, %s) = %#v, want %#v", tt.value, tt.targetType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+ALTER TABLE spatial_data
+    DROP COLUMN IF EXISTS srid,
+    DROP COLUMN IF EXISTS source_srid;
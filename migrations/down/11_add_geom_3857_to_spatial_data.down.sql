@@ -0,0 +1,2 @@
+ALTER TABLE spatial_data
+    DROP COLUMN IF EXISTS has_geom_3857;
@@ -0,0 +1,5 @@
+ALTER TABLE spatial_data
+    DROP COLUMN IF EXISTS feature_count,
+    DROP COLUMN IF EXISTS bbox,
+    DROP COLUMN IF EXISTS columns,
+    DROP COLUMN IF EXISTS size_bytes;
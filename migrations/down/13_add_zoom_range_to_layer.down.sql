@@ -0,0 +1,4 @@
+ALTER TABLE layer
+    DROP CONSTRAINT IF EXISTS layer_zoom_range,
+    DROP COLUMN IF EXISTS min_zoom,
+    DROP COLUMN IF EXISTS max_zoom;
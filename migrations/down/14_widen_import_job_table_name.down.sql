@@ -0,0 +1 @@
+ALTER TABLE import_job ALTER COLUMN table_name TYPE VARCHAR(50);
@@ -0,0 +1 @@
+ALTER TABLE spatial_data ALTER COLUMN table_name TYPE VARCHAR(50);
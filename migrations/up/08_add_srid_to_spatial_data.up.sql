@@ -0,0 +1,3 @@
+ALTER TABLE spatial_data
+    ADD COLUMN IF NOT EXISTS srid INTEGER NOT NULL DEFAULT 4326,
+    ADD COLUMN IF NOT EXISTS source_srid INTEGER;
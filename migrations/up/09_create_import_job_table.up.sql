@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS import_job (
+    id SERIAL PRIMARY KEY,
+    status VARCHAR(20) NOT NULL,
+    table_name VARCHAR(50) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    filename TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    options JSONB,
+    processed_features INTEGER NOT NULL DEFAULT 0,
+    total_features INTEGER,
+    table_names TEXT[] NOT NULL DEFAULT '{}',
+    errors TEXT[] NOT NULL DEFAULT '{}',
+    created_by VARCHAR(50) REFERENCES users(username),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS import_job_status_idx ON import_job (status, id);
@@ -0,0 +1,2 @@
+ALTER TABLE import_job
+    ADD COLUMN IF NOT EXISTS warnings TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,13 @@
+ALTER TABLE spatial_data
+    ADD COLUMN IF NOT EXISTS has_geom_3857 BOOLEAN NOT NULL DEFAULT false;
+
+-- Tables imported before spatial indexes were created on import.
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOR t IN SELECT table_name FROM spatial_data WHERE to_regclass(quote_ident(table_name)) IS NOT NULL LOOP
+        EXECUTE format('CREATE INDEX IF NOT EXISTS %I ON %I USING GIST (geom)', t || '_geom_idx', t);
+        EXECUTE format('ANALYZE %I', t);
+    END LOOP;
+END $$;
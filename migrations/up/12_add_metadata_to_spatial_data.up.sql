@@ -0,0 +1,30 @@
+ALTER TABLE spatial_data
+    ADD COLUMN IF NOT EXISTS feature_count BIGINT,
+    ADD COLUMN IF NOT EXISTS bbox DOUBLE PRECISION[],
+    ADD COLUMN IF NOT EXISTS columns JSONB,
+    ADD COLUMN IF NOT EXISTS size_bytes BIGINT;
+
+-- Fill in the metadata of tables imported before it was kept.
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOR t IN SELECT table_name FROM spatial_data WHERE to_regclass(quote_ident(table_name)) IS NOT NULL LOOP
+        EXECUTE format($sql$
+            UPDATE spatial_data SET
+                feature_count = (SELECT count(*) FROM %1$I),
+                bbox = (
+                    SELECT ARRAY[ST_XMin(e), ST_YMin(e), ST_XMax(e), ST_YMax(e)]
+                    FROM (SELECT ST_Transform(ST_SetSRID(ST_Extent(geom)::geometry, spatial_data.srid), 4326) AS e FROM %1$I) extent
+                ),
+                columns = (
+                    SELECT COALESCE(jsonb_agg(jsonb_build_object('name', column_name, 'type', upper(data_type)) ORDER BY ordinal_position), '[]')
+                    FROM information_schema.columns
+                    WHERE table_schema = current_schema() AND table_name = $1
+                        AND column_name <> ALL (ARRAY['id', 'geom', 'geom_3857', 'created_at', 'updated_at', 'created_by', 'updated_by'])
+                ),
+                size_bytes = pg_total_relation_size(to_regclass(quote_ident($1)))
+            WHERE table_name = $1
+        $sql$, t) USING t;
+    END LOOP;
+END $$;
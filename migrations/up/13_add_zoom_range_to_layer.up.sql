@@ -0,0 +1,6 @@
+ALTER TABLE layer
+    ADD COLUMN IF NOT EXISTS min_zoom SMALLINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS max_zoom SMALLINT NOT NULL DEFAULT 22;
+
+ALTER TABLE layer
+    ADD CONSTRAINT layer_zoom_range CHECK (min_zoom >= 0 AND min_zoom <= max_zoom AND max_zoom <= 22);
@@ -0,0 +1,2 @@
+-- Import jobs name tables as long as any Postgres identifier (63 bytes).
+ALTER TABLE import_job ALTER COLUMN table_name TYPE VARCHAR(63);
@@ -0,0 +1,2 @@
+ALTER TABLE import_job
+    ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP WITH TIME ZONE;
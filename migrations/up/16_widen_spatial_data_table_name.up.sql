@@ -0,0 +1,2 @@
+-- Table names may be as long as any Postgres identifier (63 bytes).
+ALTER TABLE spatial_data ALTER COLUMN table_name TYPE VARCHAR(63);